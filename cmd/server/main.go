@@ -12,10 +12,17 @@ import (
     "github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp" 
     "github.com/sirupsen/logrus"
+    "github.com/harshaSenaratne/reword/internal/cache"
 	"github.com/harshaSenaratne/reword/internal/config"
     "github.com/harshaSenaratne/reword/internal/handlers"
+    "github.com/harshaSenaratne/reword/internal/jobs"
     "github.com/harshaSenaratne/reword/internal/middleware"
+    "github.com/harshaSenaratne/reword/internal/pii"
+    "github.com/harshaSenaratne/reword/internal/policy"
+    "github.com/harshaSenaratne/reword/internal/prefilter"
     "github.com/harshaSenaratne/reword/internal/services"
+    "github.com/harshaSenaratne/reword/internal/usage"
+    "github.com/harshaSenaratne/reword/internal/webhooks"
     "github.com/harshaSenaratne/reword/pkg/llm"
 )
 
@@ -42,14 +49,96 @@ func main() {
     if err != nil {
         logger.WithError(err).Fatal("Failed to initialize LLM client")
     }
+    defer llmClient.Close()
+    
+    // Load moderation policy
+    moderationPolicy, err := policy.Load(cfg.PolicyFile)
+    if err != nil {
+        logger.WithError(err).Fatal("Failed to load moderation policy")
+    }
+    
+    // Load the local pre-filter that settles obvious comments without a model
+    filter, err := prefilter.Load(cfg.PrefilterFile)
+    if err != nil {
+        logger.WithError(err).Fatal("Failed to load pre-filter")
+    }
+    
+    // Personal data is swapped for placeholders before comments reach a model (nil disables)
+    var detector *pii.Detector
+    if cfg.PIIRedaction {
+        detector, err = pii.New(cfg.PIITypes)
+        if err != nil {
+            logger.WithError(err).Fatal("Invalid PII_TYPES")
+        }
+    }
+    
+    // Load model prices for cost accounting
+    pricing, err := usage.Load(cfg.PricingFile)
+    if err != nil {
+        logger.WithError(err).Fatal("Failed to load pricing")
+    }
+    tenants := make([]string, 0, len(cfg.APIKeyTenants))
+    for _, tenant := range cfg.APIKeyTenants {
+        tenants = append(tenants, tenant)
+    }
+    ledger := usage.NewLedger(pricing, tenants, cfg.UsageMaxEntries)
+    
+    // Initialize result cache (nil disables caching)
+    var results *cache.Results
+    if cfg.CacheEnabled {
+        backend, err := cache.New(cfg)
+        if err != nil {
+            logger.WithError(err).Fatal("Failed to initialize cache")
+        }
+        results = cache.NewResults(backend, cfg.CacheTTL)
+        defer results.Close()
+    }
+    
+    // Semantic cache reuses the results cache for near-duplicate comments; its index is per process
+    var semantic *cache.Semantic
+    if cfg.SemanticCacheEnabled && results != nil {
+        semantic = cache.NewSemantic(cfg.SemanticCacheThreshold, cfg.SemanticCacheMaxEntries, cfg.CacheTTL)
+    }
+    
+    // Webhook deliveries are stored before they are sent, so they survive restarts
+    webhookStore, err := webhooks.OpenStore(cfg.WebhooksPath)
+    if err != nil {
+        logger.WithError(err).Fatal("Failed to open webhook store")
+    }
+    defer webhookStore.Close()
+    dispatcher := webhooks.NewDispatcher(webhookStore, cfg, logger)
     
     // Initialize services
-    assistantService := services.NewAssistantService(llmClient, logger)
-    moderatorService := services.NewModeratorService(llmClient, logger)
-    chainService := services.NewChainService(assistantService, moderatorService, logger)
+    assistantService := services.NewAssistantService(llmClient, results, logger)
+    moderatorService := services.NewModeratorService(llmClient, cfg, results, semantic, logger)
+    chainService := services.NewChainService(assistantService, moderatorService, moderationPolicy, filter, detector, ledger, dispatcher, logger)
     
     // Initialize handlers
-    moderatorHandler := handlers.NewModeratorHandler(chainService, logger)
+    moderatorHandler := handlers.NewModeratorHandler(chainService, llmClient, ledger, cfg.BatchConcurrency, logger)
+    chatHandler := handlers.NewChatHandler(chainService, cfg, logger)
+    ingestHandler := handlers.NewIngestHandler(chainService, cfg.BatchConcurrency, logger)
+    
+    // Asynchronous jobs survive restarts in their own store
+    jobStore, err := jobs.OpenStore(cfg.JobsPath)
+    if err != nil {
+        logger.WithError(err).Fatal("Failed to open job store")
+    }
+    defer jobStore.Close()
+    jobRunner := jobs.NewRunner(jobStore, chainService, dispatcher, handlers.ErrorFor, cfg.JobWorkers, cfg.JobRetention, logger)
+    jobsHandler := handlers.NewJobsHandler(jobRunner, jobStore, cfg.JobMaxItems, logger)
+    webhooksHandler := handlers.NewWebhooksHandler(webhookStore, dispatcher, logger)
+    
+    runnerCtx, stopRunner := context.WithCancel(context.Background())
+    runnerDone := make(chan struct{})
+    go func() {
+        defer close(runnerDone)
+        jobRunner.Run(runnerCtx)
+    }()
+    dispatcherDone := make(chan struct{})
+    go func() {
+        defer close(dispatcherDone)
+        dispatcher.Run(runnerCtx)
+    }()
     
     // Setup Gin router
     if cfg.LogLevel != "debug" {
@@ -69,9 +158,22 @@ func main() {
     {
         // Apply rate limiting to API routes
         api.Use(middleware.RateLimitMiddleware(cfg.RateLimitPerMin))
+        api.Use(middleware.TenantMiddleware(cfg.APIKeyTenants))
         
         api.POST("/moderate", moderatorHandler.ProcessComment)
+        api.POST("/moderate/stream", moderatorHandler.StreamComment)
         api.POST("/moderate/batch", moderatorHandler.ProcessBatch)
+        api.POST("/moderate/ndjson", ingestHandler.Ingest)
+        api.GET("/chat", chatHandler.Chat)
+        api.POST("/jobs", jobsHandler.Submit)
+        api.GET("/jobs/:id", jobsHandler.Status)
+        api.GET("/jobs/:id/results", jobsHandler.Results)
+        api.GET("/usage", moderatorHandler.Usage)
+        api.POST("/webhooks", webhooksHandler.Create)
+        api.GET("/webhooks", webhooksHandler.List)
+        api.DELETE("/webhooks/:id", webhooksHandler.Delete)
+        api.GET("/webhooks/:id/deliveries", webhooksHandler.Deliveries)
+        api.POST("/webhooks/:id/deliveries/:delivery/replay", webhooksHandler.Replay)
     }
     
     // Health check
@@ -114,5 +216,10 @@ func main() {
         logger.WithError(err).Fatal("Server forced to shutdown")
     }
     
+    // Unfinished job items and webhook deliveries are picked up again on the next start
+    stopRunner()
+    <-runnerDone
+    <-dispatcherDone
+    
     logger.Info("Server shutdown complete")
 }
\ No newline at end of file
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harshaSenaratne/reword/internal/config"
+)
+
+func TestBackends(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(t *testing.T) Cache
+	}{
+		{"memory", func(t *testing.T) Cache {
+			return NewMemory(100)
+		}},
+		{"disk", func(t *testing.T) Cache {
+			d, err := NewDisk(filepath.Join(t.TempDir(), "cache", "results.db"))
+			if err != nil {
+				t.Fatalf("NewDisk: %v", err)
+			}
+			return d
+		}},
+		{"redis", func(t *testing.T) Cache {
+			r, err := NewRedis("redis://"+startFakeRedis(t)+"/0", "test:")
+			if err != nil {
+				t.Fatalf("NewRedis: %v", err)
+			}
+			return r
+		}},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := backend.open(t)
+			defer c.Close()
+
+			steps := []struct {
+				name  string
+				key   string
+				set   []byte
+				ttl   time.Duration
+				sleep time.Duration
+				want  []byte
+				found bool
+			}{
+				{name: "miss", key: "absent"},
+				{name: "set and get", key: "a", set: []byte(`{"toxic":true}`), found: true, want: []byte(`{"toxic":true}`)},
+				{name: "overwrite", key: "a", set: []byte(`{"toxic":false}`), found: true, want: []byte(`{"toxic":false}`)},
+				{name: "binary value", key: "b", set: []byte{0, 1, '\r', '\n', 255}, found: true, want: []byte{0, 1, '\r', '\n', 255}},
+				{name: "no expiry", key: "c", set: []byte("kept"), sleep: 60 * time.Millisecond, found: true, want: []byte("kept")},
+				{name: "expired", key: "d", set: []byte("gone"), ttl: 50 * time.Millisecond, sleep: 80 * time.Millisecond},
+			}
+
+			for _, step := range steps {
+				if step.set != nil {
+					if err := c.Set(ctx, step.key, step.set, step.ttl); err != nil {
+						t.Fatalf("%s: Set: %v", step.name, err)
+					}
+				}
+				time.Sleep(step.sleep)
+
+				got, found, err := c.Get(ctx, step.key)
+				if err != nil {
+					t.Fatalf("%s: Get: %v", step.name, err)
+				}
+				if found != step.found || !bytes.Equal(got, step.want) {
+					t.Errorf("%s: got %q found %v, want %q found %v", step.name, got, found, step.want, step.found)
+				}
+			}
+		})
+	}
+}
+
+func TestDiskSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "results.db")
+
+	d, err := NewDisk(path)
+	if err != nil {
+		t.Fatalf("NewDisk: %v", err)
+	}
+	d.Set(ctx, "k", []byte("v"), time.Hour)
+	d.Close()
+
+	d, err = NewDisk(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer d.Close()
+	if got, ok, err := d.Get(ctx, "k"); err != nil || !ok || string(got) != "v" {
+		t.Errorf("got %q %v %v, want the value written before reopening", got, ok, err)
+	}
+}
+
+func TestRedisPrefixesKeys(t *testing.T) {
+	ctx := context.Background()
+	addr := startFakeRedis(t)
+
+	a, err := NewRedis("redis://"+addr+"/0", "a:")
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	defer a.Close()
+	b, err := NewRedis("redis://"+addr+"/0", "b:")
+	if err != nil {
+		t.Fatalf("NewRedis: %v", err)
+	}
+	defer b.Close()
+
+	a.Set(ctx, "k", []byte("from a"), 0)
+	if _, ok, _ := b.Get(ctx, "k"); ok {
+		t.Error("a key written under one prefix is visible under another")
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		backend string
+		wantErr bool
+	}{
+		{"", false},
+		{"memory", false},
+		{"disk", false},
+		{"redis", true},
+		{"memcached", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			cfg := &config.Config{
+				CacheBackend:    tt.backend,
+				CacheMaxEntries: 10,
+				CachePath:       filepath.Join(t.TempDir(), "results.db"),
+				// Nothing listens on port 1
+				RedisURL: "redis://127.0.0.1:1/0",
+			}
+			c, err := New(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if c != nil {
+				c.Close()
+			}
+		})
+	}
+}
+
+// startFakeRedis serves the handful of commands the Redis backend sends,
+// enough to test it without a Redis server
+func startFakeRedis(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	store := &fakeRedis{values: make(map[string]fakeValue)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go store.serve(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+type fakeValue struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]fakeValue
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(f.execute(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) execute(args [][]byte) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(string(args[0])) {
+	case "PING":
+		return []byte("+PONG\r\n")
+	case "CLIENT", "SELECT":
+		return []byte("+OK\r\n")
+	case "GET":
+		value, ok := f.values[string(args[1])]
+		if !ok || !value.expiresAt.IsZero() && time.Now().After(value.expiresAt) {
+			return []byte("$-1\r\n")
+		}
+		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(value.data), value.data))
+	case "SET":
+		value := fakeValue{data: append([]byte(nil), args[2]...)}
+		for i := 3; i+1 < len(args); i += 2 {
+			n, _ := strconv.Atoi(string(args[i+1]))
+			switch strings.ToUpper(string(args[i])) {
+			case "EX":
+				value.expiresAt = time.Now().Add(time.Duration(n) * time.Second)
+			case "PX":
+				value.expiresAt = time.Now().Add(time.Duration(n) * time.Millisecond)
+			}
+		}
+		f.values[string(args[1])] = value
+		return []byte("+OK\r\n")
+	}
+	// Includes HELLO, so the client falls back to RESP2
+	return []byte(fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0]))
+}
+
+// reads one command sent as a RESP array of bulk strings
+func readCommand(reader *bufio.Reader) ([][]byte, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("bad array header %q", line)
+	}
+
+	args := make([][]byte, count)
+	for i := range args {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, fmt.Errorf("bad bulk header %q", header)
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+		args[i] = arg[:size]
+	}
+	return args, nil
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/harshaSenaratne/reword/internal/config"
+)
+
+// Cache stores opaque values with a time to live
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Close() error
+}
+
+// New creates the backend selected by CACHE_BACKEND (memory, disk or redis)
+func New(cfg *config.Config) (Cache, error) {
+	switch cfg.CacheBackend {
+	case "", "memory":
+		return NewMemory(cfg.CacheMaxEntries), nil
+	case "disk":
+		// Errors return a nil Cache, not a nil *Disk or *Redis inside one
+		disk, err := NewDisk(cfg.CachePath)
+		if err != nil {
+			return nil, err
+		}
+		return disk, nil
+	case "redis":
+		redis, err := NewRedis(cfg.RedisURL, cfg.CacheKeyPrefix)
+		if err != nil {
+			return nil, err
+		}
+		return redis, nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %q", cfg.CacheBackend)
+}
+
+var (
+	lookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_cache_lookups_total",
+		Help: "Result cache lookups by chain step and result (hit, miss, error)",
+	}, []string{"step", "result"})
+
+	evictionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_cache_evictions_total",
+		Help: "Entries removed from the in-memory cache by reason (expired, capacity)",
+	}, []string{"reason"})
+
+	entriesGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "reword_cache_entries",
+		Help: "Entries currently held in the in-memory cache",
+	})
+)
+
+// Normalize trims and collapses whitespace so trivially different comments share a key
+func Normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// Key builds a cache key for a chain step from the model, prompt version and inputs
+func Key(step, model, promptVersion string, inputs ...string) string {
+	h := sha256.New()
+	for _, part := range append([]string{step, model, promptVersion}, inputs...) {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return step + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Results caches chain step results as JSON. A nil *Results disables caching.
+type Results struct {
+	cache Cache
+	ttl   time.Duration
+}
+
+func NewResults(cache Cache, ttl time.Duration) *Results {
+	return &Results{cache: cache, ttl: ttl}
+}
+
+// Fetch returns the cached value for key, or runs compute and stores its result
+// when compute reports it as cacheable. The bool result reports a cache hit.
+func Fetch[T any](ctx context.Context, r *Results, step, key string, compute func() (T, bool, error)) (T, bool, error) {
+	if r == nil {
+		value, _, err := compute()
+		return value, false, err
+	}
+
+	if data, ok, err := r.cache.Get(ctx, key); err != nil {
+		lookupsTotal.WithLabelValues(step, "error").Inc()
+	} else if ok {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			lookupsTotal.WithLabelValues(step, "hit").Inc()
+			return value, true, nil
+		}
+		lookupsTotal.WithLabelValues(step, "error").Inc()
+	} else {
+		lookupsTotal.WithLabelValues(step, "miss").Inc()
+	}
+
+	value, cacheable, err := compute()
+	if err != nil || !cacheable {
+		return value, false, err
+	}
+
+	if data, err := json.Marshal(value); err == nil {
+		// A failed write only costs a future miss
+		_ = r.cache.Set(ctx, key, data, r.ttl)
+	}
+	return value, false, nil
+}
+
+// Close releases the underlying cache
+func (r *Results) Close() error {
+	if r == nil {
+		return nil
+	}
+	return r.cache.Close()
+}
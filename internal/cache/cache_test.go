@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type verdict struct {
+	Toxic bool    `json:"toxic"`
+	Score float64 `json:"score"`
+}
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+	results := NewResults(NewMemory(10), time.Hour)
+
+	calls := 0
+	compute := func(value verdict, cacheable bool, err error) func() (verdict, bool, error) {
+		return func() (verdict, bool, error) {
+			calls++
+			return value, cacheable, err
+		}
+	}
+
+	got, hit, err := Fetch(ctx, results, "toxicity", "k1", compute(verdict{true, 0.9}, true, nil))
+	if err != nil || hit || got != (verdict{true, 0.9}) || calls != 1 {
+		t.Fatalf("first fetch: got %+v hit %v err %v calls %d", got, hit, err, calls)
+	}
+	got, hit, err = Fetch(ctx, results, "toxicity", "k1", compute(verdict{}, true, nil))
+	if err != nil || !hit || got != (verdict{true, 0.9}) || calls != 1 {
+		t.Fatalf("second fetch: got %+v hit %v err %v calls %d", got, hit, err, calls)
+	}
+
+	// Results that aren't cacheable, and errors, are never stored
+	Fetch(ctx, results, "toxicity", "k2", compute(verdict{Score: 0.5}, false, nil))
+	Fetch(ctx, results, "toxicity", "k3", compute(verdict{}, true, errors.New("upstream failed")))
+	for _, key := range []string{"k2", "k3"} {
+		if _, hit, _ := Fetch(ctx, results, "toxicity", key, compute(verdict{}, false, nil)); hit {
+			t.Errorf("%s was cached", key)
+		}
+	}
+
+	// A nil Results disables caching
+	calls = 0
+	for i := 0; i < 2; i++ {
+		if _, hit, _ := Fetch(ctx, nil, "toxicity", "k1", compute(verdict{}, true, nil)); hit {
+			t.Error("nil Results reported a hit")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("compute ran %d times, want 2", calls)
+	}
+}
+
+func TestKey(t *testing.T) {
+	base := Key("toxicity", "gpt-4o", "v1", "you idiot")
+	tests := []struct {
+		name string
+		key  string
+		same bool
+	}{
+		{"same inputs", Key("toxicity", "gpt-4o", "v1", "you idiot"), true},
+		{"other model", Key("toxicity", "gpt-4o-mini", "v1", "you idiot"), false},
+		{"other prompt version", Key("toxicity", "gpt-4o", "v2", "you idiot"), false},
+		{"other input", Key("toxicity", "gpt-4o", "v1", "you idiots"), false},
+		{"inputs are delimited", Key("toxicity", "gpt-4o", "v1", "you", " idiot"), false},
+	}
+	for _, tt := range tests {
+		if (tt.key == base) != tt.same {
+			t.Errorf("%s: same key = %v, want %v", tt.name, tt.key == base, tt.same)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"  you   idiot \n", "you idiot"},
+		{"tab\tseparated", "tab separated"},
+		{"Case Is Kept", "Case Is Kept"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(3)
+
+	for i := 0; i < 3; i++ {
+		m.Set(ctx, fmt.Sprint(i), []byte{byte(i)}, 0)
+	}
+	// Reading 0 makes 1 the least recently used
+	m.Get(ctx, "0")
+	m.Set(ctx, "3", []byte{3}, 0)
+
+	for key, want := range map[string]bool{"0": true, "1": false, "2": true, "3": true} {
+		if _, ok, _ := m.Get(ctx, key); ok != want {
+			t.Errorf("%s present = %v, want %v", key, ok, want)
+		}
+	}
+}
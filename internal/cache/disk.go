@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var diskBucket = []byte("results")
+
+// purgeInterval between sweeps of expired entries in the disk cache
+const purgeInterval = 10 * time.Minute
+
+// Disk persists entries in an embedded bbolt file so they survive restarts
+type Disk struct {
+	db   *bolt.DB
+	done chan struct{}
+}
+
+// NewDisk opens (or creates) the cache file at path
+func NewDisk(path string) (*Disk, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache file: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(diskBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize cache file: %w", err)
+	}
+
+	d := &Disk{db: db, done: make(chan struct{})}
+	d.purge()
+	go d.purgeLoop()
+	return d, nil
+}
+
+// values are stored as an 8 byte expiry (unix nanoseconds, 0 = never) followed by the data
+func (d *Disk) Get(_ context.Context, key string) ([]byte, bool, error) {
+	var value []byte
+	expired := false
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(diskBucket).Get([]byte(key))
+		if len(raw) < 8 {
+			return nil
+		}
+		if expiresAt := int64(binary.BigEndian.Uint64(raw[:8])); expiresAt != 0 && time.Now().UnixNano() > expiresAt {
+			expired = true
+			return nil
+		}
+		value = append([]byte(nil), raw[8:]...)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if expired {
+		evictionsTotal.WithLabelValues("expired").Inc()
+		_ = d.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(diskBucket).Delete([]byte(key))
+		})
+	}
+	return value, value != nil, nil
+}
+
+func (d *Disk) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	raw := make([]byte, 8+len(value))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(raw[:8], uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	copy(raw[8:], value)
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).Put([]byte(key), raw)
+	})
+}
+
+func (d *Disk) Close() error {
+	close(d.done)
+	return d.db.Close()
+}
+
+func (d *Disk) purgeLoop() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			d.purge()
+		}
+	}
+}
+
+// removes every expired entry
+func (d *Disk) purge() {
+	now := time.Now().UnixNano()
+	_ = d.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(diskBucket).Cursor()
+		for k, v := cursor.First(); k != nil; k, v = cursor.Next() {
+			if len(v) < 8 {
+				continue
+			}
+			if expiresAt := int64(binary.BigEndian.Uint64(v[:8])); expiresAt != 0 && now > expiresAt {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				evictionsTotal.WithLabelValues("expired").Inc()
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var semanticLookupsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "reword_semantic_cache_lookups_total",
+	Help: "Semantic cache lookups by result (match, miss)",
+}, []string{"result"})
+
+// Semantic indexes comment embeddings so near-duplicates can reuse the
+// results cached for a previously seen comment. The index lives in process
+// memory whatever the cache backend: it starts empty after a restart and each
+// replica keeps its own, so near-duplicates only match comments this process
+// has seen. The embeddings themselves and the results they point at are
+// still cached in the backend.
+type Semantic struct {
+	threshold  float64
+	maxEntries int
+	ttl        time.Duration
+
+	mu      sync.RWMutex
+	entries []semanticEntry
+}
+
+type semanticEntry struct {
+	key       string
+	vector    []float32
+	expiresAt time.Time
+}
+
+// NewSemantic creates an index matching at or above threshold cosine similarity
+func NewSemantic(threshold float64, maxEntries int, ttl time.Duration) *Semantic {
+	return &Semantic{
+		threshold:  threshold,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+	}
+}
+
+// Nearest returns the key of the most similar unexpired entry above the threshold
+func (s *Semantic) Nearest(vector []float32) (string, float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	bestKey, best := "", 0.0
+	for _, entry := range s.entries {
+		if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+			continue
+		}
+		if similarity := cosine(vector, entry.vector); similarity > best {
+			bestKey, best = entry.key, similarity
+		}
+	}
+
+	if bestKey == "" || best < s.threshold {
+		semanticLookupsTotal.WithLabelValues("miss").Inc()
+		return "", best, false
+	}
+	semanticLookupsTotal.WithLabelValues("match").Inc()
+	return bestKey, best, true
+}
+
+// Add indexes key, dropping expired entries and the oldest ones beyond the size bound
+func (s *Semantic) Add(key string, vector []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	live := s.entries[:0]
+	for _, entry := range s.entries {
+		if entry.expiresAt.IsZero() || now.Before(entry.expiresAt) {
+			live = append(live, entry)
+		}
+	}
+
+	var expiresAt time.Time
+	if s.ttl > 0 {
+		expiresAt = now.Add(s.ttl)
+	}
+	live = append(live, semanticEntry{key: key, vector: vector, expiresAt: expiresAt})
+
+	if s.maxEntries > 0 && len(live) > s.maxEntries {
+		live = append(live[:0:0], live[len(live)-s.maxEntries:]...)
+	}
+	s.entries = live
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
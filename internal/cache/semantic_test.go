@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSemanticNearest(t *testing.T) {
+	s := NewSemantic(0.9, 10, time.Hour)
+	s.Add("insult", []float32{1, 0, 0})
+	s.Add("praise", []float32{0, 1, 0})
+
+	tests := []struct {
+		name   string
+		vector []float32
+		key    string
+		found  bool
+	}{
+		{"exact", []float32{1, 0, 0}, "insult", true},
+		{"near", []float32{0.95, 0.1, 0}, "insult", true},
+		{"closest of two", []float32{0.1, 0.99, 0}, "praise", true},
+		{"below threshold", []float32{0.7, 0.7, 0}, "", false},
+		{"unrelated", []float32{0, 0, 1}, "", false},
+		{"other dimensions", []float32{1, 0}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, similarity, found := s.Nearest(tt.vector)
+			if key != tt.key || found != tt.found {
+				t.Errorf("got %q %v (similarity %.3f), want %q %v", key, found, similarity, tt.key, tt.found)
+			}
+		})
+	}
+}
+
+func TestSemanticBounds(t *testing.T) {
+	s := NewSemantic(0.9, 2, time.Hour)
+	s.Add("a", []float32{1, 0, 0})
+	s.Add("b", []float32{0, 1, 0})
+	s.Add("c", []float32{0, 0, 1})
+
+	if _, _, found := s.Nearest([]float32{1, 0, 0}); found {
+		t.Error("the oldest entry was kept beyond the size bound")
+	}
+	if key, _, _ := s.Nearest([]float32{0, 0, 1}); key != "c" {
+		t.Errorf("got %q, want the newest entry", key)
+	}
+
+	expiring := NewSemantic(0.9, 10, 20*time.Millisecond)
+	expiring.Add("a", []float32{1, 0, 0})
+	time.Sleep(30 * time.Millisecond)
+	if _, _, found := expiring.Nearest([]float32{1, 0, 0}); found {
+		t.Error("an expired entry matched")
+	}
+}
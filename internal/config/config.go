@@ -4,51 +4,302 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	OpenAIAPIKey    string
-	AssistantModel  string
-	ModeratorModel  string
-	ServerPort      int
-	LogLevel        string
-	MaxTokens       int
-	Temperature     float64
-	RateLimitPerMin int
-	RequestTimeout  time.Duration
-	EnableMetrics   bool
-	CacheEnabled    bool
-	CacheTTL        time.Duration
+	OpenAIAPIKey             string
+	Assistant                ModelConfig
+	Moderator                ModelConfig
+	AssistantFallbacks       []ModelConfig
+	ModeratorFallbacks       []ModelConfig
+	ModelTimeout             time.Duration
+	ServerPort               int
+	LogLevel                 string
+	MaxTokens                int
+	Temperature              float64
+	RateLimitPerMin          int
+	RequestTimeout           time.Duration
+	EnableMetrics            bool
+	CacheEnabled             bool
+	CacheTTL                 time.Duration
+	CacheMaxEntries          int
+	CacheBackend             string
+	CachePath                string
+	RedisURL                 string
+	CacheKeyPrefix           string
+	SemanticCacheEnabled     bool
+	SemanticCacheThreshold   float64
+	SemanticCacheMaxEntries  int
+	Embedding                ModelConfig
+	CassetteMode             string
+	CassettePath             string
+	MaxRetries               int
+	RetryBaseDelay           time.Duration
+	RetryMaxDelay            time.Duration
+	BreakerThreshold         int
+	BreakerCooldown          time.Duration
+	MaxConcurrency           int
+	ModelConcurrency         map[string]int
+	MaxQueue                 int
+	QueueTimeout             time.Duration
+	BatchConcurrency         int
+	AdaptiveConcurrency      bool
+	MinConcurrency           int
+	AdaptiveMaxConcurrency   int
+	AdaptiveBackoff          float64
+	AdaptiveLatencyTolerance float64
+	ToxicityJSONMode         bool
+	ToxicityRepairAttempts   int
+	PolicyFile               string
+	PrefilterFile            string
+	NormalizeInput           bool
+	PIIRedaction             bool
+	PIITypes                 []string
+	InputTokenBudget         int
+	InputBudgetMode          string
+	PricingFile              string
+	APIKeyTenants            map[string]string
+	UsageMaxEntries          int
+	ChatMaxPending           int
+	ChatHistorySize          int
+	ChatIdleTimeout          time.Duration
+	JobsPath                 string
+	JobWorkers               int
+	JobMaxItems              int
+	JobRetention             time.Duration
+	WebhooksPath             string
+	WebhookWorkers           int
+	WebhookMaxAttempts       int
+	WebhookBackoff           time.Duration
+	WebhookTimeout           time.Duration
+	WebhookRetention         time.Duration
+	WebhookQueueSize         int
+	WebhookAllowPrivate      bool
+}
+
+// ModelConfig selects the provider backend for a single model role
+type ModelConfig struct {
+	Provider  string
+	Model     string
+	BaseURL   string
+	APIKey    string
+	Headers   map[string]string
+	RulesFile string
 }
 
 func LoadConfig() (*Config, error) {
 	_ = godotenv.Load()
 
 	cfg := &Config{
-		OpenAIAPIKey:    getEnv("OPENAI_API_KEY", ""),
-		AssistantModel:  getEnv("ASSISTANT_MODEL", "gpt-3.5-turbo"),
-		ModeratorModel:  getEnv("MODERATOR_MODEL", "gpt-4"),
-		ServerPort:      getEnvAsInt("SERVER_PORT", 8080),
-		LogLevel:        getEnv("LOG_LEVEL", "info"),
-		MaxTokens:       getEnvAsInt("MAX_TOKENS", 500),
-		Temperature:     getEnvAsFloat("TEMPERATURE", 0.7),
-		RateLimitPerMin: getEnvAsInt("RATE_LIMIT_PER_MIN", 60),
-		RequestTimeout:  getEnvAsDuration("REQUEST_TIMEOUT", 30*time.Second),
-		EnableMetrics:   getEnvAsBool("ENABLE_METRICS", true),
-		CacheEnabled:    getEnvAsBool("CACHE_ENABLED", true),
-		CacheTTL:        getEnvAsDuration("CACHE_TTL", 1*time.Hour),
+		OpenAIAPIKey:             getEnv("OPENAI_API_KEY", ""),
+		Assistant:                loadModelConfig("ASSISTANT", "gpt-3.5-turbo"),
+		Moderator:                loadModelConfig("MODERATOR", "gpt-4"),
+		ModelTimeout:             getEnvAsDuration("LLM_MODEL_TIMEOUT", 15*time.Second),
+		ServerPort:               getEnvAsInt("SERVER_PORT", 8080),
+		LogLevel:                 getEnv("LOG_LEVEL", "info"),
+		MaxTokens:                getEnvAsInt("MAX_TOKENS", 500),
+		Temperature:              getEnvAsFloat("TEMPERATURE", 0.7),
+		RateLimitPerMin:          getEnvAsInt("RATE_LIMIT_PER_MIN", 60),
+		RequestTimeout:           getEnvAsDuration("REQUEST_TIMEOUT", 30*time.Second),
+		EnableMetrics:            getEnvAsBool("ENABLE_METRICS", true),
+		CacheEnabled:             getEnvAsBool("CACHE_ENABLED", true),
+		CacheTTL:                 getEnvAsDuration("CACHE_TTL", 1*time.Hour),
+		CacheMaxEntries:          getEnvAsInt("CACHE_MAX_ENTRIES", 10000),
+		CacheBackend:             strings.ToLower(getEnv("CACHE_BACKEND", "memory")),
+		CachePath:                getEnv("CACHE_PATH", "data/cache.db"),
+		RedisURL:                 getEnv("REDIS_URL", "redis://localhost:6379/0"),
+		CacheKeyPrefix:           getEnv("CACHE_KEY_PREFIX", "reword:"),
+		SemanticCacheEnabled:     getEnvAsBool("SEMANTIC_CACHE_ENABLED", false),
+		SemanticCacheThreshold:   getEnvAsFloat("SEMANTIC_CACHE_THRESHOLD", 0.95),
+		SemanticCacheMaxEntries:  getEnvAsInt("SEMANTIC_CACHE_MAX_ENTRIES", 5000),
+		Embedding:                loadModelConfig("EMBEDDING", "text-embedding-3-small"),
+		CassetteMode:             strings.ToLower(getEnv("LLM_CASSETTE_MODE", "off")),
+		CassettePath:             getEnv("LLM_CASSETTE_PATH", "cassettes/llm.jsonl"),
+		MaxRetries:               getEnvAsInt("LLM_MAX_RETRIES", 2),
+		RetryBaseDelay:           getEnvAsDuration("LLM_RETRY_BASE_DELAY", 500*time.Millisecond),
+		RetryMaxDelay:            getEnvAsDuration("LLM_RETRY_MAX_DELAY", 10*time.Second),
+		BreakerThreshold:         getEnvAsInt("LLM_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:          getEnvAsDuration("LLM_BREAKER_COOLDOWN", 30*time.Second),
+		MaxConcurrency:           getEnvAsInt("LLM_MAX_CONCURRENCY", 8),
+		ModelConcurrency:         getEnvAsIntMap("LLM_CONCURRENCY_OVERRIDES"),
+		MaxQueue:                 getEnvAsInt("LLM_MAX_QUEUE", 32),
+		QueueTimeout:             getEnvAsDuration("LLM_QUEUE_TIMEOUT", 10*time.Second),
+		BatchConcurrency:         getEnvAsInt("BATCH_CONCURRENCY", 4),
+		AdaptiveConcurrency:      getEnvAsBool("LLM_ADAPTIVE_CONCURRENCY", false),
+		MinConcurrency:           getEnvAsInt("LLM_MIN_CONCURRENCY", 1),
+		AdaptiveMaxConcurrency:   getEnvAsInt("LLM_ADAPTIVE_MAX_CONCURRENCY", 64),
+		AdaptiveBackoff:          getEnvAsFloat("LLM_ADAPTIVE_BACKOFF", 0.5),
+		AdaptiveLatencyTolerance: getEnvAsFloat("LLM_ADAPTIVE_LATENCY_TOLERANCE", 2.0),
+		ToxicityJSONMode:         getEnvAsBool("TOXICITY_JSON_MODE", false),
+		ToxicityRepairAttempts:   getEnvAsInt("TOXICITY_REPAIR_ATTEMPTS", 1),
+		PolicyFile:               getEnv("POLICY_FILE", ""),
+		PrefilterFile:            getEnv("PREFILTER_FILE", ""),
+		NormalizeInput:           getEnvAsBool("NORMALIZE_INPUT", true),
+		PIIRedaction:             getEnvAsBool("PII_REDACTION", true),
+		PIITypes:                 getEnvAsList("PII_TYPES"),
+		InputTokenBudget:         getEnvAsInt("INPUT_TOKEN_BUDGET", 1000),
+		InputBudgetMode:          strings.ToLower(getEnv("INPUT_BUDGET_MODE", "reject")),
+		PricingFile:              getEnv("PRICING_FILE", ""),
+		APIKeyTenants:            getEnvAsMap("API_KEY_TENANTS"),
+		UsageMaxEntries:          getEnvAsInt("USAGE_MAX_ENTRIES", 10000),
+		ChatMaxPending:           getEnvAsInt("CHAT_MAX_PENDING", 8),
+		ChatHistorySize:          getEnvAsInt("CHAT_HISTORY_SIZE", 10),
+		ChatIdleTimeout:          getEnvAsDuration("CHAT_IDLE_TIMEOUT", 2*time.Minute),
+		JobsPath:                 getEnv("JOBS_PATH", "data/jobs.db"),
+		JobWorkers:               getEnvAsInt("JOB_WORKERS", 4),
+		JobMaxItems:              getEnvAsInt("JOB_MAX_ITEMS", 10000),
+		JobRetention:             getEnvAsDuration("JOB_RETENTION", 7*24*time.Hour),
+		WebhooksPath:             getEnv("WEBHOOKS_PATH", "data/webhooks.db"),
+		WebhookWorkers:           getEnvAsInt("WEBHOOK_WORKERS", 4),
+		WebhookMaxAttempts:       getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookBackoff:           getEnvAsDuration("WEBHOOK_BACKOFF", 30*time.Second),
+		WebhookTimeout:           getEnvAsDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookRetention:         getEnvAsDuration("WEBHOOK_RETENTION", 7*24*time.Hour),
+		WebhookQueueSize:         getEnvAsInt("WEBHOOK_QUEUE_SIZE", 1000),
+		WebhookAllowPrivate:      getEnvAsBool("WEBHOOK_ALLOW_PRIVATE", false),
+	}
+
+	if cfg.InputBudgetMode != "reject" && cfg.InputBudgetMode != "truncate" {
+		return nil, fmt.Errorf("INPUT_BUDGET_MODE must be reject or truncate, got %q", cfg.InputBudgetMode)
+	}
+	if cfg.ChatHistorySize < 0 {
+		return nil, fmt.Errorf("CHAT_HISTORY_SIZE must not be negative, got %d", cfg.ChatHistorySize)
+	}
+
+	cfg.AssistantFallbacks = loadFallbacks("ASSISTANT", cfg.Assistant)
+	cfg.ModeratorFallbacks = loadFallbacks("MODERATOR", cfg.Moderator)
+
+	// Replayed runs never call a provider, so they need no credentials or
+	// endpoints; embeddings aren't recorded and still do
+	if cfg.CassetteMode == "replay" {
+		if cfg.SemanticCacheEnabled {
+			if err := cfg.Embedding.validate("EMBEDDING"); err != nil {
+				return nil, err
+			}
+		}
+		return cfg, nil
 	}
 
-	if cfg.OpenAIAPIKey == "" {
-		return nil, fmt.Errorf("OPENAI_API_KEY is required")
+	if err := cfg.Assistant.validate("ASSISTANT"); err != nil {
+		return nil, err
+	}
+	if err := cfg.Moderator.validate("MODERATOR"); err != nil {
+		return nil, err
+	}
+	if cfg.SemanticCacheEnabled {
+		if err := cfg.Embedding.validate("EMBEDDING"); err != nil {
+			return nil, err
+		}
+	}
+	for _, fallback := range cfg.AssistantFallbacks {
+		if err := fallback.validate("ASSISTANT_FALLBACK"); err != nil {
+			return nil, err
+		}
+	}
+	for _, fallback := range cfg.ModeratorFallbacks {
+		if err := fallback.validate("MODERATOR_FALLBACK"); err != nil {
+			return nil, err
+		}
 	}
 
 	return cfg, nil
 }
 
+// reads <PREFIX>_PROVIDER, _MODEL, _BASE_URL, _API_KEY, _HEADERS and _RULES_FILE
+func loadModelConfig(prefix, defaultModel string) ModelConfig {
+	provider := strings.ToLower(getEnv(prefix+"_PROVIDER", "openai"))
+
+	return ModelConfig{
+		Provider:  provider,
+		Model:     getEnv(prefix+"_MODEL", defaultModel),
+		BaseURL:   getEnv(prefix+"_BASE_URL", ""),
+		APIKey:    getEnv(prefix+"_API_KEY", defaultAPIKey(provider)),
+		Headers:   getEnvAsMap(prefix + "_HEADERS"),
+		RulesFile: getEnv(prefix+"_RULES_FILE", getEnv("FAKE_RULES_FILE", "")),
+	}
+}
+
+// reads <PREFIX>_FALLBACK_MODELS, a comma separated list of [provider:]model
+// entries tried in order after the primary. Entries on the primary's provider
+// share its endpoint and credentials; others use the provider-wide settings
+// (OPENAI_BASE_URL, OLLAMA_BASE_URL, ANTHROPIC_API_KEY, ...).
+func loadFallbacks(prefix string, primary ModelConfig) []ModelConfig {
+	valueStr := getEnv(prefix+"_FALLBACK_MODELS", "")
+	if valueStr == "" {
+		return nil
+	}
+
+	var fallbacks []ModelConfig
+	for _, entry := range strings.Split(valueStr, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		provider, model := primary.Provider, entry
+		if p, m, ok := strings.Cut(entry, ":"); ok && isKnownProvider(p) {
+			provider, model = strings.ToLower(p), m
+		}
+
+		if provider == primary.Provider {
+			fallback := primary
+			fallback.Model = model
+			fallbacks = append(fallbacks, fallback)
+			continue
+		}
+
+		envPrefix := strings.ToUpper(strings.ReplaceAll(provider, "-", "_"))
+		fallbacks = append(fallbacks, ModelConfig{
+			Provider:  provider,
+			Model:     model,
+			BaseURL:   getEnv(envPrefix+"_BASE_URL", ""),
+			APIKey:    defaultAPIKey(provider),
+			RulesFile: getEnv("FAKE_RULES_FILE", ""),
+		})
+	}
+	return fallbacks
+}
+
+func isKnownProvider(name string) bool {
+	switch strings.ToLower(name) {
+	case "openai", "openai-compatible", "anthropic", "ollama", "fake":
+		return true
+	}
+	return false
+}
+
+func defaultAPIKey(provider string) string {
+	switch provider {
+	case "openai", "openai-compatible":
+		return getEnv("OPENAI_API_KEY", "")
+	case "anthropic":
+		return getEnv("ANTHROPIC_API_KEY", "")
+	}
+	return ""
+}
+
+func (m ModelConfig) validate(prefix string) error {
+	switch m.Provider {
+	case "openai":
+		if m.APIKey == "" {
+			return fmt.Errorf("OPENAI_API_KEY is required")
+		}
+	case "anthropic":
+		if m.APIKey == "" {
+			return fmt.Errorf("ANTHROPIC_API_KEY is required")
+		}
+	case "openai-compatible":
+		if m.BaseURL == "" {
+			return fmt.Errorf("%s_BASE_URL is required for openai-compatible provider", prefix)
+		}
+	}
+	return nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -86,4 +337,44 @@ func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
 		return value
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// reads a comma separated list, lowercased
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, ""), ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parses comma separated key=value pairs
+func getEnvAsMap(key string) map[string]string {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return nil
+	}
+
+	values := make(map[string]string)
+	for _, pair := range strings.Split(valueStr, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return values
+}
+
+// parses comma separated key=number pairs, skipping invalid numbers
+func getEnvAsIntMap(key string) map[string]int {
+	values := make(map[string]int)
+	for k, v := range getEnvAsMap(key) {
+		if n, err := strconv.Atoi(v); err == nil {
+			values[k] = n
+		}
+	}
+	return values
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  string
+	}{
+		{"negative chat history", "CHAT_HISTORY_SIZE", "-1", "CHAT_HISTORY_SIZE must not be negative"},
+		{"unknown budget mode", "INPUT_BUDGET_MODE", "drop", "INPUT_BUDGET_MODE must be reject or truncate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ASSISTANT_PROVIDER", "fake")
+			t.Setenv("MODERATOR_PROVIDER", "fake")
+			t.Setenv(tt.key, tt.value)
+			_, err := LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// No history is allowed
+	t.Setenv("ASSISTANT_PROVIDER", "fake")
+	t.Setenv("MODERATOR_PROVIDER", "fake")
+	t.Setenv("CHAT_HISTORY_SIZE", "0")
+	if _, err := LoadConfig(); err != nil {
+		t.Errorf("CHAT_HISTORY_SIZE=0: %v", err)
+	}
+}
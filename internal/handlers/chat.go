@@ -0,0 +1,291 @@
+package handlers
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/gorilla/websocket"
+    "github.com/sirupsen/logrus"
+    "github.com/harshaSenaratne/reword/internal/config"
+    "github.com/harshaSenaratne/reword/internal/models"
+    "github.com/harshaSenaratne/reword/internal/services"
+    "github.com/harshaSenaratne/reword/pkg/llm"
+)
+
+const (
+    chatWriteTimeout  = 10 * time.Second
+    chatMaxFrameBytes = 64 << 10
+)
+
+// Origins are as open as the CORS policy of the REST API
+var upgrader = websocket.Upgrader{
+    ReadBufferSize:  1024,
+    WriteBufferSize: 1024,
+    CheckOrigin:     func(*http.Request) bool { return true },
+}
+
+type ChatHandler struct {
+    chainService *services.ChainService
+    config       *config.Config
+    logger       *logrus.Logger
+}
+
+func NewChatHandler(chainService *services.ChainService, cfg *config.Config, logger *logrus.Logger) *ChatHandler {
+    return &ChatHandler{
+        chainService: chainService,
+        config:       cfg,
+        logger:       logger,
+    }
+}
+
+// chatConn is one live chat connection. Messages are moderated one at a time
+// in arrival order; when the client sends faster than that, up to
+// ChatMaxPending wait and the rest are refused. A client that stops reading
+// its events is disconnected rather than buffered without bound.
+type chatConn struct {
+    conn    *websocket.Conn
+    handler *ChatHandler
+    tenant  string
+    context models.ModerationContext
+
+    pending chan models.ChatMessage
+    events  chan models.ChatEvent
+    cancel  context.CancelFunc
+    once    sync.Once
+}
+
+//  upgrades to a WebSocket and moderates every message pushed over it
+func (h *ChatHandler) Chat(c *gin.Context) {
+    conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+    if err != nil {
+        // The upgrader has already answered the client
+        h.logger.WithError(err).Warn("WebSocket upgrade failed")
+        return
+    }
+
+    ctx, cancel := context.WithCancel(c.Request.Context())
+    defer cancel()
+
+    size := h.config.ChatMaxPending
+    if size < 1 {
+        size = 1
+    }
+    cc := &chatConn{
+        conn:    conn,
+        handler: h,
+        tenant:  c.GetString("tenant"),
+        context: models.ModerationContext{ConversationID: conversationID()},
+        pending: make(chan models.ChatMessage, size),
+        events:  make(chan models.ChatEvent, size),
+        cancel:  cancel,
+    }
+
+    logger := h.logger.WithField("conversation_id", cc.context.ConversationID)
+    logger.Info("Chat connection opened")
+
+    var wg sync.WaitGroup
+    wg.Add(2)
+    go func() {
+        defer wg.Done()
+        cc.writeLoop(ctx)
+    }()
+    go func() {
+        defer wg.Done()
+        cc.processLoop(ctx)
+        close(cc.events)
+    }()
+
+    cc.send(models.ChatEvent{Type: models.ChatReady, ConversationID: cc.context.ConversationID})
+    cc.readLoop()
+
+    close(cc.pending)
+    cancel()
+    wg.Wait()
+    conn.Close()
+    logger.Info("Chat connection closed")
+}
+
+// reads messages until the client goes away or stays silent past the idle timeout
+func (cc *chatConn) readLoop() {
+    idle := cc.handler.config.ChatIdleTimeout
+    cc.conn.SetReadLimit(chatMaxFrameBytes)
+    cc.extend(idle)
+    cc.conn.SetPongHandler(func(string) error {
+        cc.extend(idle)
+        return nil
+    })
+
+    for {
+        var message models.ChatMessage
+        if err := cc.conn.ReadJSON(&message); err != nil {
+            var closeErr *websocket.CloseError
+            if !errors.As(err, &closeErr) {
+                cc.handler.logger.WithError(err).Debug("Chat read ended")
+            }
+            return
+        }
+        cc.extend(idle)
+
+        if strings.TrimSpace(message.Comment) == "" {
+            cc.fail(message.ID, http.StatusBadRequest, "Invalid Request", "comment is required")
+            continue
+        }
+
+        select {
+        case cc.pending <- message:
+        default:
+            cc.fail(message.ID, http.StatusTooManyRequests, "Too Many Pending Messages", "wait for earlier messages to be answered")
+        }
+    }
+}
+
+// pushes the read deadline out, or clears the one the HTTP server left behind
+func (cc *chatConn) extend(idle time.Duration) {
+    var deadline time.Time
+    if idle > 0 {
+        deadline = time.Now().Add(idle)
+    }
+    cc.conn.SetReadDeadline(deadline)
+}
+
+// moderates queued messages in order, carrying the conversation forward
+func (cc *chatConn) processLoop(ctx context.Context) {
+    for message := range cc.pending {
+        if ctx.Err() != nil {
+            continue
+        }
+
+        userID := message.UserID
+        if userID == "" {
+            userID = cc.context.UserID
+        }
+        cc.context.UserID = userID
+
+        req := &models.CommentRequest{
+            Comment:   message.Comment,
+            Sentiment: message.Sentiment,
+            UserID:    userID,
+            Tenant:    cc.tenant,
+            History:   append([]models.Message(nil), cc.context.PreviousContext...),
+        }
+        response, err := cc.handler.chainService.ProcessComment(ctx, req)
+        if err != nil {
+            cc.failWith(message.ID, err)
+            continue
+        }
+
+        cc.remember(message.Comment, response)
+        cc.send(models.ChatEvent{Type: models.ChatResult, ID: message.ID, Response: response})
+    }
+}
+
+// adds a published exchange to the conversation, keeping the newest turns.
+// Withheld comments never happened as far as the conversation is concerned.
+func (cc *chatConn) remember(comment string, response *models.ModeratedResponse) {
+    if response.AssistantReply == "" {
+        return
+    }
+
+    if response.WasModified {
+        comment = response.ModeratedInput
+    }
+    now := time.Now()
+    history := append(cc.context.PreviousContext,
+        models.Message{Role: models.RoleUser, Content: comment, Timestamp: now},
+        models.Message{Role: models.RoleAssistant, Content: response.AssistantReply, Timestamp: now},
+    )
+    if limit := cc.handler.config.ChatHistorySize; len(history) > limit {
+        history = append([]models.Message(nil), history[len(history)-limit:]...)
+    }
+    cc.context.PreviousContext = history
+}
+
+func (cc *chatConn) failWith(id string, err error) {
+    switch {
+    case errors.Is(err, services.ErrInputTooLong):
+        cc.send(models.ChatEvent{Type: models.ChatError, ID: id, Error: ErrorFor(err)})
+    case errors.Is(err, llm.ErrOverloaded):
+        cc.send(models.ChatEvent{
+            Type:       models.ChatError,
+            ID:         id,
+            Error:      ErrorFor(err),
+            RetryAfter: retryAfterSeconds(err),
+        })
+    case errors.Is(err, context.Canceled):
+        // The connection is going away
+    default:
+        cc.handler.logger.WithError(err).Error("Failed to process chat message")
+        cc.send(models.ChatEvent{Type: models.ChatError, ID: id, Error: ErrorFor(err)})
+    }
+}
+
+func (cc *chatConn) fail(id string, code int, title, message string) {
+    cc.send(models.ChatEvent{
+        Type:  models.ChatError,
+        ID:    id,
+        Error: &models.ErrorResponse{Error: title, Message: message, Code: code},
+    })
+}
+
+// queues an event for the writer, dropping the connection if the client has
+// let a full buffer of events pile up unread
+func (cc *chatConn) send(event models.ChatEvent) {
+    select {
+    case cc.events <- event:
+    default:
+        cc.once.Do(func() {
+            cc.handler.logger.WithField("conversation_id", cc.context.ConversationID).Warn("Chat client is not reading, disconnecting")
+            cc.cancel()
+            cc.conn.Close()
+        })
+    }
+}
+
+// owns every write to the socket, including keepalive pings
+func (cc *chatConn) writeLoop(ctx context.Context) {
+    var ping <-chan time.Time
+    if idle := cc.handler.config.ChatIdleTimeout; idle > 0 {
+        ticker := time.NewTicker(idle / 2)
+        defer ticker.Stop()
+        ping = ticker.C
+    }
+
+    for {
+        select {
+        case event, ok := <-cc.events:
+            if !ok {
+                cc.conn.SetWriteDeadline(time.Now().Add(chatWriteTimeout))
+                cc.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+                return
+            }
+            cc.conn.SetWriteDeadline(time.Now().Add(chatWriteTimeout))
+            if err := cc.conn.WriteJSON(event); err != nil {
+                cc.cancel()
+                cc.conn.Close()
+                return
+            }
+        case <-ping:
+            cc.conn.SetWriteDeadline(time.Now().Add(chatWriteTimeout))
+            if err := cc.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+                cc.cancel()
+                cc.conn.Close()
+                return
+            }
+        case <-ctx.Done():
+            return
+        }
+    }
+}
+
+func conversationID() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
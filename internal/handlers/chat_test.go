@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/harshaSenaratne/reword/pkg/llm"
+)
+
+// echoHistory makes the assistant reply with the oldest user turn it was shown
+func echoHistory(t *testing.T) {
+	t.Helper()
+	assistantRules(t, []llm.FakeRule{
+		{Match: `(?s)Analyze the sentiment`, Response: "neutral"},
+		{Match: `Conversation so far:\nUser: "([^"]*)"`, Response: "remembers $1"},
+		{Match: `(?s)assistant`, Response: "no history"},
+	})
+}
+
+func dialChat(t *testing.T) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(newTestRouter(t))
+	t.Cleanup(server.Close)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/chat"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) models.ChatEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event models.ChatEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("ReadJSON: %v", err)
+	}
+	return event
+}
+
+func TestChatCarriesConversation(t *testing.T) {
+	echoHistory(t)
+	// One exchange, a user turn and an assistant turn
+	t.Setenv("CHAT_HISTORY_SIZE", "2")
+	conn := dialChat(t)
+
+	if event := readEvent(t, conn); event.Type != models.ChatReady || event.ConversationID == "" {
+		t.Fatalf("first event %+v, want ready", event)
+	}
+
+	tests := []struct {
+		id       string
+		comment  string
+		reply    []string
+		notReply []string
+	}{
+		{"1", "where is my parcel", []string{"no history"}, nil},
+		{"2", "it was due on monday", []string{"where is my parcel"}, nil},
+		{"3", "you are an idiot", []string{"it was due on monday"}, []string{"where is my parcel"}},
+		// The rewrite is what the conversation remembers
+		{"4", "any news", []string{"I am unhappy with this"}, []string{"idiot"}},
+	}
+	for _, tt := range tests {
+		if err := conn.WriteJSON(models.ChatMessage{ID: tt.id, Comment: tt.comment}); err != nil {
+			t.Fatalf("WriteJSON: %v", err)
+		}
+		event := readEvent(t, conn)
+		if event.Type != models.ChatResult || event.ID != tt.id || event.Response == nil {
+			t.Fatalf("message %s: got %+v", tt.id, event)
+		}
+		for _, want := range tt.reply {
+			if !strings.Contains(event.Response.AssistantReply, want) {
+				t.Errorf("message %s: reply %q is missing %q", tt.id, event.Response.AssistantReply, want)
+			}
+		}
+		for _, unwanted := range tt.notReply {
+			if strings.Contains(event.Response.AssistantReply, unwanted) {
+				t.Errorf("message %s: reply %q still has %q", tt.id, event.Response.AssistantReply, unwanted)
+			}
+		}
+	}
+}
+
+func TestChatRejectsEmptyComments(t *testing.T) {
+	conn := dialChat(t)
+	readEvent(t, conn)
+
+	if err := conn.WriteJSON(models.ChatMessage{ID: "blank", Comment: "  "}); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	event := readEvent(t, conn)
+	if event.Type != models.ChatError || event.ID != "blank" || event.Error == nil || event.Error.Code != http.StatusBadRequest {
+		t.Errorf("got %+v, want a 400 error for the message", event)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "net/http"
+
+    "github.com/harshaSenaratne/reword/internal/models"
+    "github.com/harshaSenaratne/reword/internal/services"
+    "github.com/harshaSenaratne/reword/pkg/llm"
+)
+
+// statusClientClosedRequest is the de facto code for a client that hung up
+const statusClientClosedRequest = 499
+
+// ErrorFor describes a chain error the way the API reports it. Every handler
+// answers errors with it, and the jobs runner records failed items with it.
+func ErrorFor(err error) *models.ErrorResponse {
+    switch {
+    case errors.Is(err, services.ErrInvalidItem):
+        return &models.ErrorResponse{
+            Error:   "Invalid Request",
+            Message: err.Error(),
+            Code:    http.StatusBadRequest,
+        }
+    case errors.Is(err, services.ErrInputTooLong):
+        return &models.ErrorResponse{
+            Error:   "Comment Too Long",
+            Message: err.Error(),
+            Code:    http.StatusRequestEntityTooLarge,
+        }
+    case errors.Is(err, context.Canceled):
+        return &models.ErrorResponse{
+            Error:   "Cancelled",
+            Message: "The request was cancelled before this comment was processed",
+            Code:    statusClientClosedRequest,
+        }
+    case errors.Is(err, context.DeadlineExceeded):
+        return &models.ErrorResponse{
+            Error:   "Timed Out",
+            Message: "The request timed out before this comment was processed",
+            Code:    http.StatusGatewayTimeout,
+        }
+    case errors.Is(err, llm.ErrOverloaded):
+        return &models.ErrorResponse{
+            Error:   "Service Overloaded",
+            Message: "Too many requests in flight, please retry later",
+            Code:    http.StatusServiceUnavailable,
+        }
+    }
+    return &models.ErrorResponse{
+        Error:   "Processing Failed",
+        Message: "Failed to process comment",
+        Code:    http.StatusInternalServerError,
+    }
+}
+
+// reports an item's outcome, with its error described the way the API does
+func itemResult(outcome services.ItemOutcome) models.ItemResult {
+    switch {
+    case outcome.Cancelled:
+        return models.ItemResult{Index: outcome.Index, Status: models.ItemCancelled, Error: ErrorFor(outcome.Err)}
+    case outcome.Err != nil:
+        return models.ItemResult{Index: outcome.Index, Status: models.ItemFailed, Error: ErrorFor(outcome.Err)}
+    }
+    return models.ItemResult{Index: outcome.Index, Status: models.ItemSucceeded, Response: outcome.Response}
+}
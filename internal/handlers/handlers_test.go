@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/harshaSenaratne/reword/internal/config"
+	"github.com/harshaSenaratne/reword/internal/jobs"
+	"github.com/harshaSenaratne/reword/internal/middleware"
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/harshaSenaratne/reword/internal/pii"
+	"github.com/harshaSenaratne/reword/internal/policy"
+	"github.com/harshaSenaratne/reword/internal/prefilter"
+	"github.com/harshaSenaratne/reword/internal/services"
+	"github.com/harshaSenaratne/reword/internal/usage"
+	"github.com/harshaSenaratne/reword/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestRouter wires the API the way main does, against the fake provider.
+// Settings the test has put in the environment take effect.
+func newTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	t.Setenv("ASSISTANT_PROVIDER", "fake")
+	t.Setenv("MODERATOR_PROVIDER", "fake")
+	t.Setenv("CACHE_ENABLED", "false")
+	t.Setenv("API_KEY_TENANTS", "k1=acme,k2=globex")
+	t.Setenv("JOBS_PATH", filepath.Join(dir, "jobs.db"))
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	llmClient, err := llm.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { llmClient.Close() })
+
+	detector, err := pii.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ledger := usage.NewLedger(usage.Default(), []string{"acme", "globex"}, cfg.UsageMaxEntries)
+
+	assistantService := services.NewAssistantService(llmClient, nil, logger)
+	moderatorService := services.NewModeratorService(llmClient, cfg, nil, nil, logger)
+	chainService := services.NewChainService(assistantService, moderatorService, policy.Default(), prefilter.Default(), detector, ledger, nil, logger)
+
+	moderatorHandler := NewModeratorHandler(chainService, llmClient, ledger, cfg.BatchConcurrency, logger)
+	ingestHandler := NewIngestHandler(chainService, cfg.BatchConcurrency, logger)
+	chatHandler := NewChatHandler(chainService, cfg, logger)
+
+	jobStore, err := jobs.OpenStore(cfg.JobsPath)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	jobRunner := jobs.NewRunner(jobStore, chainService, nil, ErrorFor, cfg.JobWorkers, cfg.JobRetention, logger)
+	jobsHandler := NewJobsHandler(jobRunner, jobStore, cfg.JobMaxItems, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		jobRunner.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		jobStore.Close()
+	})
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+	api.Use(middleware.TenantMiddleware(cfg.APIKeyTenants))
+	api.POST("/moderate", moderatorHandler.ProcessComment)
+	api.POST("/moderate/batch", moderatorHandler.ProcessBatch)
+	api.POST("/moderate/stream", moderatorHandler.StreamComment)
+	api.GET("/chat", chatHandler.Chat)
+	api.POST("/moderate/ndjson", ingestHandler.Ingest)
+	api.POST("/jobs", jobsHandler.Submit)
+	api.GET("/jobs/:id", jobsHandler.Status)
+	api.GET("/jobs/:id/results", jobsHandler.Results)
+	api.GET("/usage", moderatorHandler.Usage)
+	return router
+}
+
+// assistantRules answers assistant prompts from rules instead of the fake provider's defaults
+func assistantRules(t *testing.T, rules []llm.FakeRule) {
+	t.Helper()
+	data, err := json.Marshal(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "assistant.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("ASSISTANT_RULES_FILE", path)
+}
+
+func do(t *testing.T, router http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+}
+
+func TestProcessComment(t *testing.T) {
+	router := newTestRouter(t)
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		action   string
+		modified bool
+	}{
+		{"clean comment is allowed", `{"comment": "Thanks for the quick delivery"}`, http.StatusOK, models.ActionAllow, false},
+		{"toxic comment is rewritten", `{"comment": "you are an idiot"}`, http.StatusOK, models.ActionRewrite, true},
+		{"missing comment", `{}`, http.StatusBadRequest, "", false},
+		{"malformed body", `{"comment":`, http.StatusBadRequest, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(t, router, http.MethodPost, "/api/v1/moderate", "", tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var resp models.ModeratedResponse
+			decode(t, w, &resp)
+			if resp.Action != tt.action || resp.WasModified != tt.modified {
+				t.Errorf("action %q modified %v, want %q %v", resp.Action, resp.WasModified, tt.action, tt.modified)
+			}
+			if resp.AssistantReply == "" {
+				t.Error("missing assistant reply")
+			}
+		})
+	}
+}
+
+func TestUsageIsScopedToTenant(t *testing.T) {
+	router := newTestRouter(t)
+
+	if w := do(t, router, http.MethodGet, "/api/v1/usage", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a key: status %d, want 401", w.Code)
+	}
+	// Keys outside the configured list don't get a tenant of their own
+	if w := do(t, router, http.MethodPost, "/api/v1/moderate", "made-up", `{"comment": "hello"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status %d, want 401", w.Code)
+	}
+
+	do(t, router, http.MethodPost, "/api/v1/moderate", "k1", `{"comment": "you idiot", "user_id": "u1"}`)
+	do(t, router, http.MethodPost, "/api/v1/moderate", "k2", `{"comment": "hello", "user_id": "u2"}`)
+
+	w := do(t, router, http.MethodGet, "/api/v1/usage", "k1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var report usage.Report
+	decode(t, w, &report)
+	if report.Tenant != "acme" {
+		t.Errorf("tenant %q, want acme", report.Tenant)
+	}
+	if _, ok := report.Users["u2"]; ok {
+		t.Error("report includes another tenant's user")
+	}
+	if _, ok := report.Users["u1"]; !ok {
+		t.Errorf("report is missing the caller's user: %+v", report.Users)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	router := newTestRouter(t)
+
+	if w := do(t, router, http.MethodPost, "/api/v1/jobs", "k1", `{"items": [{"comment": "hi"}, null]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("null item: status %d, want 400", w.Code)
+	}
+
+	w := do(t, router, http.MethodPost, "/api/v1/jobs", "k1", `{"items": [{"comment": "Thanks"}, {"comment": "you idiot"}]}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("submit: status %d: %s", w.Code, w.Body.String())
+	}
+	var job models.Job
+	decode(t, w, &job)
+
+	// Jobs belong to the tenant that submitted them
+	for _, key := range []string{"", "k2"} {
+		if w := do(t, router, http.MethodGet, "/api/v1/jobs/"+job.ID, key, ""); w.Code != http.StatusNotFound {
+			t.Errorf("status as %q: %d, want 404", key, w.Code)
+		}
+		if w := do(t, router, http.MethodGet, "/api/v1/jobs/"+job.ID+"/results", key, ""); w.Code != http.StatusNotFound {
+			t.Errorf("results as %q: %d, want 404", key, w.Code)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.FinishedAt == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s", job.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+		w := do(t, router, http.MethodGet, "/api/v1/jobs/"+job.ID, "k1", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("status: %d: %s", w.Code, w.Body.String())
+		}
+		decode(t, w, &job)
+	}
+	if job.Succeeded != 2 || job.Failed != 0 {
+		t.Errorf("succeeded %d failed %d, want 2 0", job.Succeeded, job.Failed)
+	}
+
+	w = do(t, router, http.MethodGet, "/api/v1/jobs/"+job.ID+"/results", "k1", "")
+	var results models.JobResults
+	decode(t, w, &results)
+	if results.Total != 2 || len(results.Items) != 2 || !results.Items[1].Response.WasModified {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
+
+func TestProcessBatchPerItemErrors(t *testing.T) {
+	router := newTestRouter(t)
+
+	body := `[{"comment": "Great service"}, null, {"comment": "this sucks"}]`
+	w := do(t, router, http.MethodPost, "/api/v1/moderate/batch", "", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	var batch models.BatchResponse
+	decode(t, w, &batch)
+	if batch.Count != 3 || batch.Succeeded != 2 || batch.Failed != 1 {
+		t.Fatalf("count %d succeeded %d failed %d, want 3 2 1", batch.Count, batch.Succeeded, batch.Failed)
+	}
+	for i, item := range batch.Results {
+		if item.Index != i {
+			t.Errorf("result %d has index %d", i, item.Index)
+		}
+	}
+	if item := batch.Results[1]; item.Error == nil || item.Error.Code != http.StatusBadRequest {
+		t.Errorf("null item: got %+v, want a 400 error", item)
+	}
+	if item := batch.Results[2]; item.Response == nil || !item.Response.WasModified {
+		t.Errorf("toxic item: got %+v, want a rewrite", item)
+	}
+
+	tooMany := "[" + strings.TrimSuffix(strings.Repeat(`{"comment": "ok"},`, 11), ",") + "]"
+	if w := do(t, router, http.MethodPost, "/api/v1/moderate/batch", "", tooMany); w.Code != http.StatusBadRequest {
+		t.Errorf("oversized batch: status %d, want 400", w.Code)
+	}
+}
+
+func TestIngestKeepsLineUserID(t *testing.T) {
+	router := newTestRouter(t)
+
+	w := do(t, router, http.MethodPost, "/api/v1/moderate/ndjson", "k1", `{"comment": "you idiot", "user_id": "u9"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	var report usage.Report
+	decode(t, do(t, router, http.MethodGet, "/api/v1/usage", "k1", ""), &report)
+	if report.Users["u9"].Requests != 1 {
+		t.Errorf("the line's user was not charged: %+v", report.Users)
+	}
+}
+
+func TestIngestKeepsInputOrder(t *testing.T) {
+	router := newTestRouter(t)
+
+	lines := []string{
+		`{"comment": "Thanks a lot"}`,
+		`not json`,
+		`{"comment": "you idiot"}`,
+		``,
+		`null`,
+		`{"comment": "the parcel arrived"}`,
+	}
+	w := do(t, router, http.MethodPost, "/api/v1/moderate/ndjson", "", strings.Join(lines, "\n"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	want := []int{http.StatusOK, http.StatusBadRequest, http.StatusOK, http.StatusBadRequest, http.StatusOK}
+	var got []models.ItemResult
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var item models.ItemResult
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			t.Fatalf("decode line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, item)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d result lines, want %d", len(got), len(want))
+	}
+	for i, item := range got {
+		if item.Index != i {
+			t.Errorf("line %d has index %d", i, item.Index)
+		}
+		status := http.StatusOK
+		if item.Error != nil {
+			status = item.Error.Code
+		}
+		if status != want[i] {
+			t.Errorf("line %d: status %d, want %d", i, status, want[i])
+		}
+	}
+}
+
+func TestProcessCommentRedactsPII(t *testing.T) {
+	router := newTestRouter(t)
+
+	w := do(t, router, http.MethodPost, "/api/v1/moderate", "", `{"comment": "Please write to jane.doe@example.com about my order"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp models.ModeratedResponse
+	decode(t, w, &resp)
+	if len(resp.PII) != 1 {
+		t.Fatalf("got %d findings, want 1: %+v", len(resp.PII), resp.PII)
+	}
+	finding := resp.PII[0]
+	if finding.Type != models.PIIEmail || finding.Placeholder != "[EMAIL_1]" || finding.Start != 16 || finding.End != 36 {
+		t.Errorf("unexpected finding %+v", finding)
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/gin-gonic/gin/binding"
+    "github.com/sirupsen/logrus"
+    "github.com/harshaSenaratne/reword/internal/models"
+    "github.com/harshaSenaratne/reword/internal/services"
+)
+
+const (
+    ingestMaxLineBytes = 64 << 10
+    // ingestIdleTimeout is how long the client may go without sending a line
+    ingestIdleTimeout = time.Minute
+    ingestWriteTimeout = 10 * time.Second
+)
+
+var errLineTooLong = fmt.Errorf("line exceeds %d bytes", ingestMaxLineBytes)
+
+type IngestHandler struct {
+    chainService *services.ChainService
+    concurrency  int
+    logger       *logrus.Logger
+}
+
+func NewIngestHandler(chainService *services.ChainService, concurrency int, logger *logrus.Logger) *IngestHandler {
+    if concurrency < 1 {
+        concurrency = 1
+    }
+    return &IngestHandler{
+        chainService: chainService,
+        concurrency:  concurrency,
+        logger:       logger,
+    }
+}
+
+//  moderates a newline-delimited stream of comments, answering each line with
+//  a result line in input order as soon as it and every line before it are done.
+//  Neither side is buffered whole: once the in-flight limit is reached reading
+//  waits for results to be written, and writing waits for the client to read.
+func (h *IngestHandler) Ingest(c *gin.Context) {
+    // Reading the rest of the body while results go out needs a full-duplex
+    // connection, and an upload of any length must outlive the server timeouts
+    rc := http.NewResponseController(c.Writer)
+    if err := rc.EnableFullDuplex(); err != nil {
+        h.logger.WithError(err).Debug("Full duplex unavailable")
+    }
+    rc.SetWriteDeadline(time.Time{})
+
+    ctx, cancel := context.WithCancel(c.Request.Context())
+    defer cancel()
+
+    // A user ID from the context overrides the one on each line, if there is one
+    var userID string
+    if value, exists := c.Get("user_id"); exists {
+        userID, _ = value.(string)
+    }
+    tenant := c.GetString("tenant")
+
+    // Results queue up in input order; the queue and the in-flight slots
+    // together bound how far reading runs ahead of writing
+    queue := make(chan chan models.ItemResult, h.concurrency)
+    slots := make(chan struct{}, h.concurrency)
+
+    lines := 0
+    go func() {
+        defer close(queue)
+        reader := bufio.NewReader(c.Request.Body)
+        for ctx.Err() == nil {
+            rc.SetReadDeadline(time.Now().Add(ingestIdleTimeout))
+            line, err := readLine(reader)
+            last := errors.Is(err, io.EOF)
+            if err != nil && !last && !errors.Is(err, errLineTooLong) {
+                h.logger.WithError(err).Warn("Ingest read ended")
+                cancel()
+                return
+            }
+            if err == nil || last {
+                if len(bytes.TrimSpace(line)) == 0 {
+                    if last {
+                        return
+                    }
+                    continue
+                }
+                err = nil
+            }
+
+            index := lines
+            lines++
+            result := make(chan models.ItemResult, 1)
+            select {
+            case queue <- result:
+            case <-ctx.Done():
+                return
+            }
+
+            req, err := parseLine(line, err)
+            if err != nil {
+                result <- invalidItem(index, err)
+            } else {
+                h.process(ctx, index, req, userID, tenant, slots, result)
+            }
+            if last {
+                return
+            }
+        }
+    }()
+
+    c.Header("Content-Type", "application/x-ndjson")
+    c.Header("Cache-Control", "no-cache")
+    c.Header("X-Accel-Buffering", "no")
+    // Headers go out with the first result: writing them before the body is
+    // read would refuse a client waiting on 100-continue
+    c.Status(http.StatusOK)
+
+    encoder := json.NewEncoder(c.Writer)
+    written := 0
+    for result := range queue {
+        item := <-result
+        if ctx.Err() != nil {
+            continue
+        }
+        rc.SetWriteDeadline(time.Now().Add(ingestWriteTimeout))
+        if err := encoder.Encode(item); err != nil {
+            // Stop the reader and let the remaining items cancel
+            h.logger.WithError(err).Warn("Ingest client went away")
+            cancel()
+            continue
+        }
+        c.Writer.Flush()
+        written++
+    }
+
+    h.logger.WithFields(logrus.Fields{
+        "lines":   lines,
+        "written": written,
+    }).Info("Ingest finished")
+}
+
+// starts moderating a line once an in-flight slot is free
+func (h *IngestHandler) process(ctx context.Context, index int, req *models.CommentRequest, userID, tenant string, slots chan struct{}, result chan<- models.ItemResult) {
+    if req != nil {
+        if userID != "" {
+            req.UserID = userID
+        }
+        req.Tenant = tenant
+    }
+
+    select {
+    case slots <- struct{}{}:
+    case <-ctx.Done():
+        // ProcessItem marks it cancelled without running it
+        result <- itemResult(h.chainService.ProcessItem(ctx, index, req))
+        return
+    }
+    go func() {
+        defer func() { <-slots }()
+        result <- itemResult(h.chainService.ProcessItem(ctx, index, req))
+    }()
+}
+
+// reads one line without its newline. A line over the limit is skipped up to
+// its newline and reported as errLineTooLong. The last line may end in EOF.
+func readLine(reader *bufio.Reader) ([]byte, error) {
+    var line []byte
+    for {
+        chunk, err := reader.ReadSlice('\n')
+        line = append(line, chunk...)
+        if len(bytes.TrimRight(line, "\r\n")) > ingestMaxLineBytes {
+            for errors.Is(err, bufio.ErrBufferFull) {
+                _, err = reader.ReadSlice('\n')
+            }
+            if err != nil && !errors.Is(err, io.EOF) {
+                return nil, err
+            }
+            return nil, errLineTooLong
+        }
+        if !errors.Is(err, bufio.ErrBufferFull) {
+            return bytes.TrimRight(line, "\r\n"), err
+        }
+    }
+}
+
+// decodes and validates a line, passing null through for ProcessItem to answer
+func parseLine(line []byte, readErr error) (*models.CommentRequest, error) {
+    if errors.Is(readErr, errLineTooLong) {
+        return nil, readErr
+    }
+
+    var req *models.CommentRequest
+    if err := json.Unmarshal(line, &req); err != nil {
+        return nil, err
+    }
+    if req == nil {
+        return nil, nil
+    }
+    if err := binding.Validator.ValidateStruct(req); err != nil {
+        return nil, err
+    }
+    return req, nil
+}
+
+func invalidItem(index int, err error) models.ItemResult {
+    return models.ItemResult{
+        Index:  index,
+        Status: models.ItemFailed,
+        Error: &models.ErrorResponse{
+            Error:   "Invalid Request",
+            Message: err.Error(),
+            Code:    http.StatusBadRequest,
+        },
+    }
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/sirupsen/logrus"
+    "github.com/harshaSenaratne/reword/internal/jobs"
+    "github.com/harshaSenaratne/reword/internal/models"
+)
+
+const (
+    defaultPageSize = 100
+    maxPageSize     = 1000
+)
+
+type JobsHandler struct {
+    runner   *jobs.Runner
+    store    *jobs.Store
+    maxItems int
+    logger   *logrus.Logger
+}
+
+func NewJobsHandler(runner *jobs.Runner, store *jobs.Store, maxItems int, logger *logrus.Logger) *JobsHandler {
+    return &JobsHandler{
+        runner:   runner,
+        store:    store,
+        maxItems: maxItems,
+        logger:   logger,
+    }
+}
+
+//  queues comments for asynchronous moderation and answers with the job to poll
+func (h *JobsHandler) Submit(c *gin.Context) {
+    var req models.JobRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        h.logger.WithError(err).Error("Invalid job payload")
+        c.JSON(http.StatusBadRequest, models.ErrorResponse{
+            Error:   "Invalid Request",
+            Message: err.Error(),
+            Code:    http.StatusBadRequest,
+        })
+        return
+    }
+    // dive skips null items, which would reach the runner as nil requests
+    for i, item := range req.Items {
+        if item == nil {
+            c.JSON(http.StatusBadRequest, models.ErrorResponse{
+                Error:   "Invalid Request",
+                Message: fmt.Sprintf("item %d: must be a comment object", i),
+                Code:    http.StatusBadRequest,
+            })
+            return
+        }
+    }
+
+    if h.maxItems > 0 && len(req.Items) > h.maxItems {
+        c.JSON(http.StatusBadRequest, models.ErrorResponse{
+            Error:   "Job Too Large",
+            Message: fmt.Sprintf("Maximum %d comments per job", h.maxItems),
+            Code:    http.StatusBadRequest,
+        })
+        return
+    }
+
+    job, err := h.runner.Submit(c.GetString("tenant"), req.Items)
+    if err != nil {
+        h.logger.WithError(err).Error("Failed to submit job")
+        c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+            Error:   "Job Submission Failed",
+            Message: "Failed to submit job",
+            Code:    http.StatusInternalServerError,
+        })
+        return
+    }
+
+    h.logger.WithFields(logrus.Fields{
+        "job_id": job.ID,
+        "items":  job.Total,
+    }).Info("Job submitted")
+
+    c.Header("Location", "/api/v1/jobs/"+job.ID)
+    c.JSON(http.StatusAccepted, job)
+}
+
+//  reports a job's status and progress
+func (h *JobsHandler) Status(c *gin.Context) {
+    job, err := h.store.Get(c.GetString("tenant"), c.Param("id"))
+    if err != nil {
+        h.storeError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, job)
+}
+
+//  returns a page of a job's results, ?offset=0&limit=100
+func (h *JobsHandler) Results(c *gin.Context) {
+    offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+    if err != nil || offset < 0 {
+        h.invalidPage(c, "offset must be a non-negative integer")
+        return
+    }
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+    if err != nil || limit < 1 || limit > maxPageSize {
+        h.invalidPage(c, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+        return
+    }
+
+    id := c.Param("id")
+    job, err := h.store.Get(c.GetString("tenant"), id)
+    if err != nil {
+        h.storeError(c, err)
+        return
+    }
+    items, err := h.store.Results(id, offset, limit)
+    if err != nil {
+        h.storeError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, models.JobResults{
+        JobID:  id,
+        Offset: offset,
+        Limit:  limit,
+        Total:  job.Total,
+        Items:  items,
+    })
+}
+
+func (h *JobsHandler) invalidPage(c *gin.Context, message string) {
+    c.JSON(http.StatusBadRequest, models.ErrorResponse{
+        Error:   "Invalid Request",
+        Message: message,
+        Code:    http.StatusBadRequest,
+    })
+}
+
+func (h *JobsHandler) storeError(c *gin.Context, err error) {
+    if errors.Is(err, jobs.ErrNotFound) {
+        c.JSON(http.StatusNotFound, models.ErrorResponse{
+            Error:   "Not Found",
+            Message: "No job with this ID",
+            Code:    http.StatusNotFound,
+        })
+        return
+    }
+
+    h.logger.WithError(err).Error("Failed to read job")
+    c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+        Error:   "Job Lookup Failed",
+        Message: "Failed to read job",
+        Code:    http.StatusInternalServerError,
+    })
+}
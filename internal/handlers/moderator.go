@@ -1,24 +1,39 @@
 package handlers
 
 import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
     "net/http"
+    "strconv"
     "time"
     
     "github.com/gin-gonic/gin"
+    "github.com/gin-gonic/gin/binding"
     "github.com/sirupsen/logrus"
     "github.com/harshaSenaratne/reword/internal/models"
     "github.com/harshaSenaratne/reword/internal/services"
+    "github.com/harshaSenaratne/reword/internal/usage"
+    "github.com/harshaSenaratne/reword/pkg/llm"
 )
 
 type ModeratorHandler struct {
-    chainService *services.ChainService
-    logger       *logrus.Logger
+    chainService     *services.ChainService
+    llmClient        *llm.Client
+    ledger           *usage.Ledger
+    batchConcurrency int
+    logger           *logrus.Logger
 }
 
-func NewModeratorHandler(chainService *services.ChainService, logger *logrus.Logger) *ModeratorHandler {
+// batchConcurrency bounds how many comments of one batch run at once (0 means unbounded)
+func NewModeratorHandler(chainService *services.ChainService, llmClient *llm.Client, ledger *usage.Ledger, batchConcurrency int, logger *logrus.Logger) *ModeratorHandler {
     return &ModeratorHandler{
-        chainService: chainService,
-        logger:       logger,
+        chainService:     chainService,
+        llmClient:        llmClient,
+        ledger:           ledger,
+        batchConcurrency: batchConcurrency,
+        logger:           logger,
     }
 }
 
@@ -39,16 +54,17 @@ func (h *ModeratorHandler) ProcessComment(c *gin.Context) {
     if userID, exists := c.Get("user_id"); exists {
         req.UserID = userID.(string)
     }
+    req.Tenant = c.GetString("tenant")
 
     ctx := c.Request.Context()
     response, err := h.chainService.ProcessComment(ctx, &req)
+    if h.rejected(c, err) {
+        return
+    }
     if err != nil {
         h.logger.WithError(err).Error("Failed to process comment")
-        c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-            Error:   "Processing Failed",
-            Message: "Failed to process comment",
-            Code:    http.StatusInternalServerError,
-        })
+        response := ErrorFor(err)
+        c.JSON(response.Code, response)
         return
     }
 
@@ -58,7 +74,7 @@ func (h *ModeratorHandler) ProcessComment(c *gin.Context) {
 //  handles batch comment processing
 func (h *ModeratorHandler) ProcessBatch(c *gin.Context) {
     var requests []*models.CommentRequest
-    if err := c.ShouldBindJSON(&requests); err != nil {
+    if err := bindBatch(c, &requests); err != nil {
         h.logger.WithError(err).Error("Invalid batch request payload")
         c.JSON(http.StatusBadRequest, models.ErrorResponse{
             Error:   "Invalid Request",
@@ -77,29 +93,128 @@ func (h *ModeratorHandler) ProcessBatch(c *gin.Context) {
         return
     }
 
-    ctx := c.Request.Context()
-    responses, err := h.chainService.ProcessBatch(ctx, requests)
-    if err != nil {
-        h.logger.WithError(err).Error("Failed to process batch")
-        c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-            Error:   "Batch Processing Failed",
-            Message: "Failed to process batch",
-            Code:    http.StatusInternalServerError,
+    tenant := c.GetString("tenant")
+    for _, req := range requests {
+        if req != nil {
+            req.Tenant = tenant
+        }
+    }
+
+    // Every item is answered on its own; when the client goes away the
+    // request context cancels whatever hasn't run yet
+    outcomes := h.chainService.ProcessBatch(c.Request.Context(), h.batchConcurrency, requests)
+    batch := &models.BatchResponse{Results: make([]models.ItemResult, len(outcomes)), Count: len(outcomes)}
+    for i, outcome := range outcomes {
+        result := itemResult(outcome)
+        batch.Results[i] = result
+        switch result.Status {
+        case models.ItemSucceeded:
+            batch.Succeeded++
+        case models.ItemCancelled:
+            batch.Cancelled++
+        default:
+            batch.Failed++
+        }
+    }
+    h.logger.WithFields(logrus.Fields{
+        "count":     batch.Count,
+        "succeeded": batch.Succeeded,
+        "failed":    batch.Failed,
+        "cancelled": batch.Cancelled,
+    }).Info("Batch processed")
+
+    c.JSON(http.StatusOK, batch)
+}
+
+// decodes a batch and validates its items. Null items are left for
+// ProcessBatch to answer one by one; the validator would panic on them.
+func bindBatch(c *gin.Context, requests *[]*models.CommentRequest) error {
+    if err := c.ShouldBindWith(requests, jsonDecoder{}); err != nil {
+        return err
+    }
+    for i, req := range *requests {
+        if req == nil {
+            continue
+        }
+        if err := binding.Validator.ValidateStruct(req); err != nil {
+            return fmt.Errorf("item %d: %w", i, err)
+        }
+    }
+    return nil
+}
+
+// jsonDecoder is binding.JSON without the validation pass
+type jsonDecoder struct{}
+
+func (jsonDecoder) Name() string { return "json" }
+
+func (jsonDecoder) Bind(req *http.Request, obj any) error {
+    if req == nil || req.Body == nil {
+        return errors.New("invalid request")
+    }
+    return json.NewDecoder(req.Body).Decode(obj)
+}
+
+// answers errors the client can act on: 413 for comments over the token
+// budget and 503 with a Retry-After hint when a model's queue is full
+func (h *ModeratorHandler) rejected(c *gin.Context, err error) bool {
+    switch {
+    case errors.Is(err, services.ErrInputTooLong):
+        c.JSON(http.StatusRequestEntityTooLarge, ErrorFor(err))
+        return true
+    case errors.Is(err, llm.ErrOverloaded):
+        h.overloaded(c, err)
+        return true
+    }
+    return false
+}
+
+func (h *ModeratorHandler) overloaded(c *gin.Context, err error) {
+    h.logger.WithError(err).Warn("Rejecting request, model overloaded")
+
+    c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(err)))
+    c.JSON(http.StatusServiceUnavailable, ErrorFor(err))
+}
+
+// whole seconds a client should wait after an overload error, at least one
+func retryAfterSeconds(err error) int {
+    retryAfter, _ := llm.RetryAfter(err)
+    seconds := int(math.Ceil(retryAfter.Seconds()))
+    if seconds < 1 {
+        seconds = 1
+    }
+    return seconds
+}
+
+// Usage reports the caller's tokens and estimated cost since startup, per user
+func (h *ModeratorHandler) Usage(c *gin.Context) {
+    tenant := c.GetString("tenant")
+    if tenant == "" {
+        c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+            Error:   "Unauthorized",
+            Message: "An API key is required to read usage",
+            Code:    http.StatusUnauthorized,
         })
         return
     }
-
-    c.JSON(http.StatusOK, gin.H{
-        "responses": responses,
-        "count":     len(responses),
-    })
+    c.JSON(http.StatusOK, h.ledger.Report(tenant))
 }
 
-// Health handles health check
+// Health handles health check, reporting degraded while any model circuit is open
 func (h *ModeratorHandler) Health(c *gin.Context) {
+    circuits := h.llmClient.CircuitStates()
+
+    status := "healthy"
+    for _, state := range circuits {
+        if state != llm.CircuitClosed.String() {
+            status = "degraded"
+        }
+    }
+
     c.JSON(http.StatusOK, models.HealthResponse{
-        Status:    "healthy",
+        Status:    status,
         Version:   "1.0.0",
+        Circuits:  circuits,
         Timestamp: time.Now(),
     })
 }
\ No newline at end of file
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/harshaSenaratne/reword/internal/models"
+)
+
+// streamWriteTimeout bounds each event write, since a stream outlives the
+// server's WriteTimeout
+const streamWriteTimeout = 10 * time.Second
+
+// sseObserver writes chain events to the client as Server-Sent Events
+type sseObserver struct {
+    c       *gin.Context
+    rc      *http.ResponseController
+    started bool
+}
+
+func (o *sseObserver) Stage(event string, data any) {
+    o.send(event, data)
+}
+
+func (o *sseObserver) Chunk(text string) error {
+    o.send(models.EventToken, models.TokenEvent{Text: text})
+    return o.c.Request.Context().Err()
+}
+
+func (o *sseObserver) Reset() {
+    o.send(models.EventReset, gin.H{})
+}
+
+func (o *sseObserver) send(event string, data any) {
+    if !o.started {
+        o.c.Header("Cache-Control", "no-cache")
+        o.c.Header("Connection", "keep-alive")
+        o.c.Header("X-Accel-Buffering", "no")
+        o.started = true
+    }
+    o.rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+    o.c.SSEvent(event, data)
+    o.c.Writer.Flush()
+}
+
+//  streams a comment's chain stages and then the reply, token by token, as SSE
+func (h *ModeratorHandler) StreamComment(c *gin.Context) {
+    var req models.CommentRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        h.logger.WithError(err).Error("Invalid request payload")
+        c.JSON(http.StatusBadRequest, models.ErrorResponse{
+            Error:   "Invalid Request",
+            Message: err.Error(),
+            Code:    http.StatusBadRequest,
+        })
+        return
+    }
+
+    if userID, exists := c.Get("user_id"); exists {
+        req.UserID = userID.(string)
+    }
+    req.Tenant = c.GetString("tenant")
+
+    // A reply streams for as long as the models take, past the server's WriteTimeout
+    rc := http.NewResponseController(c.Writer)
+    rc.SetWriteDeadline(time.Time{})
+
+    observer := &sseObserver{c: c, rc: rc}
+    response, err := h.chainService.ProcessCommentStream(c.Request.Context(), &req, observer)
+    if err != nil {
+        h.logger.WithError(err).Error("Failed to stream comment")
+
+        // Until the first event is out the client can still get a proper status
+        if !observer.started {
+            if h.rejected(c, err) {
+                return
+            }
+            response := ErrorFor(err)
+            c.JSON(response.Code, response)
+            return
+        }
+        observer.send(models.EventError, ErrorFor(err))
+        return
+    }
+
+    observer.send(models.EventDone, response)
+}
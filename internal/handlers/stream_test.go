@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/harshaSenaratne/reword/pkg/llm"
+)
+
+// slowReply makes the assistant take its time over the reply
+func slowReply(t *testing.T, delay time.Duration) {
+	t.Helper()
+	assistantRules(t, []llm.FakeRule{
+		{Match: `(?s)Analyze the sentiment`, Response: "neutral"},
+		{Match: `(?s)assistant`, Response: "Thanks for letting us know, we are on it.", DelayMS: int(delay / time.Millisecond)},
+	})
+}
+
+type sseEvent struct {
+	name string
+	data string
+}
+
+func readEvents(t *testing.T, resp *http.Response) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			current.name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			current.data += strings.TrimPrefix(line, "data:")
+		case line == "" && current.name != "":
+			events = append(events, current)
+			current = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestStreamCommentOutlivesWriteTimeout(t *testing.T) {
+	slowReply(t, 300*time.Millisecond)
+	server := httptest.NewUnstartedServer(newTestRouter(t))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/v1/moderate/stream", "application/json", strings.NewReader(`{"comment": "you are an idiot"}`))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := readEvents(t, resp)
+	var names []string
+	var reply strings.Builder
+	for _, event := range events {
+		if len(names) == 0 || names[len(names)-1] != event.name {
+			names = append(names, event.name)
+		}
+		if event.name == models.EventToken {
+			var token models.TokenEvent
+			json.Unmarshal([]byte(event.data), &token)
+			reply.WriteString(token.Text)
+		}
+	}
+	want := []string{models.EventToxicity, models.EventDecision, models.EventModerated, models.EventSentiment, models.EventToken, models.EventDone}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("events %v, want %v", names, want)
+	}
+
+	var done models.ModeratedResponse
+	if err := json.Unmarshal([]byte(events[len(events)-1].data), &done); err != nil {
+		t.Fatalf("decode done: %v", err)
+	}
+	if !done.WasModified || done.AssistantReply != reply.String() {
+		t.Errorf("done %+v, streamed reply %q", done, reply.String())
+	}
+}
+
+func TestStreamCommentRejectsBadRequests(t *testing.T) {
+	router := newTestRouter(t)
+	w := do(t, router, http.MethodPost, "/api/v1/moderate/stream", "", `{}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", w.Code)
+	}
+}
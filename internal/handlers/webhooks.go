@@ -0,0 +1,185 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+
+    "github.com/gin-gonic/gin"
+    "github.com/sirupsen/logrus"
+    "github.com/harshaSenaratne/reword/internal/models"
+    "github.com/harshaSenaratne/reword/internal/webhooks"
+)
+
+const (
+    defaultDeliveryPage = 50
+    maxDeliveryPage     = 500
+)
+
+type WebhooksHandler struct {
+    store      *webhooks.Store
+    dispatcher *webhooks.Dispatcher
+    logger     *logrus.Logger
+}
+
+func NewWebhooksHandler(store *webhooks.Store, dispatcher *webhooks.Dispatcher, logger *logrus.Logger) *WebhooksHandler {
+    return &WebhooksHandler{
+        store:      store,
+        dispatcher: dispatcher,
+        logger:     logger,
+    }
+}
+
+//  registers a webhook for the caller's tenant and returns its signing secret, once
+func (h *WebhooksHandler) Create(c *gin.Context) {
+    tenant, ok := h.tenant(c)
+    if !ok {
+        return
+    }
+
+    var req models.WebhookRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        h.invalid(c, err.Error())
+        return
+    }
+    // Deliveries come from inside our network, so they mustn't be aimed back at it
+    if err := h.dispatcher.CheckURL(c.Request.Context(), req.URL); err != nil {
+        h.invalid(c, err.Error())
+        return
+    }
+
+    hook, err := h.store.Create(tenant, req)
+    if err != nil {
+        h.logger.WithError(err).Error("Failed to create webhook")
+        c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+            Error:   "Webhook Creation Failed",
+            Message: "Failed to create webhook",
+            Code:    http.StatusInternalServerError,
+        })
+        return
+    }
+
+    h.logger.WithFields(logrus.Fields{
+        "webhook_id": hook.ID,
+        "tenant":     tenant,
+        "events":     hook.Events,
+    }).Info("Webhook created")
+
+    c.Header("Location", "/api/v1/webhooks/"+hook.ID)
+    c.JSON(http.StatusCreated, hook)
+}
+
+//  lists the caller's webhooks, without their secrets
+func (h *WebhooksHandler) List(c *gin.Context) {
+    tenant, ok := h.tenant(c)
+    if !ok {
+        return
+    }
+
+    hooks, err := h.store.List(tenant)
+    if err != nil {
+        h.storeError(c, err)
+        return
+    }
+    for _, hook := range hooks {
+        hook.Secret = ""
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "webhooks": hooks,
+        "count":    len(hooks),
+    })
+}
+
+//  removes a webhook; deliveries still queued for it are marked failed
+func (h *WebhooksHandler) Delete(c *gin.Context) {
+    tenant, ok := h.tenant(c)
+    if !ok {
+        return
+    }
+
+    if err := h.store.Delete(tenant, c.Param("id")); err != nil {
+        h.storeError(c, err)
+        return
+    }
+    c.Status(http.StatusNoContent)
+}
+
+//  returns a webhook's most recent deliveries, ?limit=50
+func (h *WebhooksHandler) Deliveries(c *gin.Context) {
+    tenant, ok := h.tenant(c)
+    if !ok {
+        return
+    }
+
+    limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDeliveryPage)))
+    if err != nil || limit < 1 || limit > maxDeliveryPage {
+        h.invalid(c, fmt.Sprintf("limit must be between 1 and %d", maxDeliveryPage))
+        return
+    }
+
+    deliveries, err := h.store.Deliveries(tenant, c.Param("id"), limit)
+    if err != nil {
+        h.storeError(c, err)
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "deliveries": deliveries,
+        "count":      len(deliveries),
+    })
+}
+
+//  sends an earlier delivery's event again as a new delivery
+func (h *WebhooksHandler) Replay(c *gin.Context) {
+    tenant, ok := h.tenant(c)
+    if !ok {
+        return
+    }
+
+    delivery, err := h.dispatcher.Replay(tenant, c.Param("id"), c.Param("delivery"))
+    if err != nil {
+        h.storeError(c, err)
+        return
+    }
+    c.JSON(http.StatusAccepted, delivery)
+}
+
+// webhooks belong to a tenant, so managing them takes an API key
+func (h *WebhooksHandler) tenant(c *gin.Context) (string, bool) {
+    tenant := c.GetString("tenant")
+    if tenant == "" {
+        c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+            Error:   "Unauthorized",
+            Message: "An API key is required to manage webhooks",
+            Code:    http.StatusUnauthorized,
+        })
+        return "", false
+    }
+    return tenant, true
+}
+
+func (h *WebhooksHandler) invalid(c *gin.Context, message string) {
+    c.JSON(http.StatusBadRequest, models.ErrorResponse{
+        Error:   "Invalid Request",
+        Message: message,
+        Code:    http.StatusBadRequest,
+    })
+}
+
+func (h *WebhooksHandler) storeError(c *gin.Context, err error) {
+    if errors.Is(err, webhooks.ErrNotFound) {
+        c.JSON(http.StatusNotFound, models.ErrorResponse{
+            Error:   "Not Found",
+            Message: "No such webhook or delivery",
+            Code:    http.StatusNotFound,
+        })
+        return
+    }
+
+    h.logger.WithError(err).Error("Failed to read webhooks")
+    c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+        Error:   "Webhook Lookup Failed",
+        Message: "Failed to read webhooks",
+        Code:    http.StatusInternalServerError,
+    })
+}
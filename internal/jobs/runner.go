@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/harshaSenaratne/reword/internal/services"
+	"github.com/harshaSenaratne/reword/pkg/llm"
+)
+
+const (
+	// purgeInterval between sweeps of jobs past their retention
+	purgeInterval = time.Hour
+	// retryInterval before picking a job back up after a storage error
+	retryInterval = 5 * time.Second
+)
+
+var itemsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "reword_job_items_total",
+	Help: "Job items processed by result (succeeded, failed)",
+}, []string{"result"})
+
+// Runner works through stored jobs one at a time, oldest first, spreading each
+// job's items over a pool of workers. Progress is recorded per item, so a
+// restart resumes with the items that had no result yet.
+type Runner struct {
+	store     *Store
+	chain     *services.ChainService
+	notifier  services.Notifier
+	errorFor  ErrorFunc
+	workers   int
+	retention time.Duration
+	wake      chan struct{}
+	logger    *logrus.Logger
+}
+
+type task struct {
+	jobID  string
+	tenant string
+	index  int
+	done   *sync.WaitGroup
+}
+
+// ErrorFunc describes an item's error the way the API reports it
+type ErrorFunc func(error) *models.ErrorResponse
+
+// notifier, which may be nil, hears about every completed job. errorFor
+// describes the errors of failed items.
+func NewRunner(store *Store, chain *services.ChainService, notifier services.Notifier, errorFor ErrorFunc, workers int, retention time.Duration, logger *logrus.Logger) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Runner{
+		store:     store,
+		chain:     chain,
+		notifier:  notifier,
+		errorFor:  errorFor,
+		workers:   workers,
+		retention: retention,
+		wake:      make(chan struct{}, 1),
+		logger:    logger,
+	}
+}
+
+// Submit stores a job and wakes the runner
+func (r *Runner) Submit(tenant string, requests []*models.CommentRequest) (*models.Job, error) {
+	job, err := r.store.Create(tenant, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Run processes jobs until ctx is cancelled, then waits for in-flight items
+func (r *Runner) Run(ctx context.Context) {
+	tasks := make(chan task)
+	var workers sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for t := range tasks {
+				r.process(ctx, t)
+				t.done.Done()
+			}
+		}()
+	}
+	defer func() {
+		close(tasks)
+		workers.Wait()
+	}()
+
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+	r.purge()
+
+	for ctx.Err() == nil {
+		ids, err := r.store.Unfinished()
+		if err != nil {
+			r.logger.WithError(err).Error("Failed to list pending jobs")
+		}
+		if len(ids) > 0 {
+			if err := r.runJob(ctx, ids[0], tasks); err != nil {
+				r.logger.WithError(err).WithField("job_id", ids[0]).Error("Job interrupted, retrying")
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryInterval):
+				}
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-r.wake:
+		case <-purge.C:
+			r.purge()
+		}
+	}
+}
+
+func (r *Runner) runJob(ctx context.Context, id string, tasks chan<- task) error {
+	job, err := r.store.Start(id)
+	if err != nil {
+		return fmt.Errorf("failed to start job: %w", err)
+	}
+	pending, err := r.store.Pending(id)
+	if err != nil {
+		return fmt.Errorf("failed to load job items: %w", err)
+	}
+
+	logger := r.logger.WithFields(logrus.Fields{
+		"job_id":  id,
+		"pending": len(pending),
+		"total":   job.Total,
+	})
+	logger.Info("Running job")
+
+	var done sync.WaitGroup
+	for _, index := range pending {
+		done.Add(1)
+		select {
+		case tasks <- task{jobID: id, tenant: job.Tenant, index: index, done: &done}:
+		case <-ctx.Done():
+			done.Done()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	done.Wait()
+
+	// Interrupted items stay pending for the next start
+	if ctx.Err() != nil {
+		return nil
+	}
+	if remaining, err := r.store.Pending(id); err != nil || len(remaining) > 0 {
+		return fmt.Errorf("%d items could not be recorded: %v", len(remaining), err)
+	}
+	job, err = r.store.Finish(id)
+	if err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+	logger.Info("Job completed")
+	if r.notifier != nil {
+		r.notifier.Notify(job.Tenant, models.WebhookJobCompleted, job)
+	}
+	return nil
+}
+
+// moderates one item, waiting out overload instead of failing the item
+func (r *Runner) process(ctx context.Context, t task) {
+	req, err := r.store.Request(t.jobID, t.index)
+	if err != nil {
+		// Left pending, the item would hold the job open and be retried on every start
+		r.logger.WithError(err).WithFields(logrus.Fields{
+			"job_id": t.jobID,
+			"index":  t.index,
+		}).Error("Failed to load job item")
+		r.record(t.jobID, models.ItemResult{Index: t.index, Status: models.ItemFailed, Error: &models.ErrorResponse{
+			Error:   "Unreadable Item",
+			Message: fmt.Sprintf("The stored comment could not be read: %v", err),
+			Code:    http.StatusInternalServerError,
+		}})
+		return
+	}
+	if req == nil {
+		// Stored before null items were rejected; fail it rather than retry it forever
+		r.record(t.jobID, models.ItemResult{Index: t.index, Status: models.ItemFailed, Error: r.errorFor(services.ErrInvalidItem)})
+		return
+	}
+	req.Tenant = t.tenant
+
+	for {
+		response, err := r.chain.ProcessComment(ctx, req)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, llm.ErrOverloaded) {
+			wait, _ := llm.RetryAfter(err)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			continue
+		}
+
+		result := models.ItemResult{Index: t.index, Status: models.ItemSucceeded, Response: response}
+		if err != nil {
+			r.logger.WithError(err).WithFields(logrus.Fields{
+				"job_id": t.jobID,
+				"index":  t.index,
+			}).Warn("Job item failed")
+			result = models.ItemResult{Index: t.index, Status: models.ItemFailed, Error: r.errorFor(err)}
+		}
+		r.record(t.jobID, result)
+		return
+	}
+}
+
+func (r *Runner) record(jobID string, result models.ItemResult) {
+	itemsTotal.WithLabelValues(result.Status).Inc()
+	if err := r.store.Record(jobID, result); err != nil {
+		r.logger.WithError(err).WithField("job_id", jobID).Error("Failed to record job item")
+	}
+}
+
+func (r *Runner) purge() {
+	if r.retention <= 0 {
+		return
+	}
+	purged, err := r.store.Purge(time.Now().Add(-r.retention))
+	if err != nil {
+		r.logger.WithError(err).Warn("Failed to purge old jobs")
+		return
+	}
+	if purged > 0 {
+		r.logger.WithField("purged", purged).Info("Purged expired jobs")
+	}
+}
@@ -0,0 +1,349 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+// ErrNotFound is returned for unknown job IDs
+var ErrNotFound = errors.New("job not found")
+
+// errCorruptItem marks an item whose stored JSON can't be decoded
+var errCorruptItem = errors.New("corrupt job item")
+
+var (
+	jobsBucket  = []byte("jobs")
+	itemsBucket = []byte("items")
+)
+
+// item is what the store keeps per comment: the request and, once processed, its result
+type item struct {
+	Request *models.CommentRequest `json:"request"`
+	Result  *models.ItemResult     `json:"result,omitempty"`
+}
+
+// Store persists jobs and their items in a bbolt file. Every job gets a
+// bucket under "items" keyed by the big-endian item index.
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens (or creates) the job file at path
+func OpenStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job file: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(jobsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(itemsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize job file: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create stores a new queued job with its requests
+func (s *Store) Create(tenant string, requests []*models.CommentRequest) (*models.Job, error) {
+	job := &models.Job{
+		ID:        newID(),
+		Status:    models.JobQueued,
+		Total:     len(requests),
+		Tenant:    tenant,
+		CreatedAt: time.Now(),
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		items, err := tx.Bucket(itemsBucket).CreateBucket([]byte(job.ID))
+		if err != nil {
+			return err
+		}
+		for i, req := range requests {
+			data, err := json.Marshal(item{Request: req})
+			if err != nil {
+				return err
+			}
+			if err := items.Put(indexKey(i), data); err != nil {
+				return err
+			}
+		}
+		return putJob(tx, job)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store job: %w", err)
+	}
+	return job, nil
+}
+
+// Get returns one of a tenant's jobs by ID
+func (s *Store) Get(tenant, id string) (*models.Job, error) {
+	var job *models.Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = getJob(tx, id)
+		if err == nil && job.Tenant != tenant {
+			// Another tenant's job is as good as missing
+			return ErrNotFound
+		}
+		return err
+	})
+	return job, err
+}
+
+// Unfinished lists the IDs of queued and running jobs, oldest first
+func (s *Store) Unfinished() ([]string, error) {
+	var ids []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var job models.Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if job.Status != models.JobCompleted {
+				ids = append(ids, job.ID)
+			}
+			return nil
+		})
+	})
+	return ids, err
+}
+
+// Start marks a job running, keeping the original start time on a resume
+func (s *Store) Start(id string) (*models.Job, error) {
+	var job *models.Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if job, err = getJob(tx, id); err != nil {
+			return err
+		}
+		job.Status = models.JobRunning
+		if job.StartedAt == nil {
+			now := time.Now()
+			job.StartedAt = &now
+		}
+		return putJob(tx, job)
+	})
+	return job, err
+}
+
+// Finish marks a job completed
+func (s *Store) Finish(id string) (*models.Job, error) {
+	var job *models.Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if job, err = getJob(tx, id); err != nil {
+			return err
+		}
+		now := time.Now()
+		job.Status = models.JobCompleted
+		job.FinishedAt = &now
+		return putJob(tx, job)
+	})
+	return job, err
+}
+
+// Pending lists the indexes of items without a result
+func (s *Store) Pending(id string) ([]int, error) {
+	var pending []int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		items := tx.Bucket(itemsBucket).Bucket([]byte(id))
+		if items == nil {
+			return ErrNotFound
+		}
+		return items.ForEach(func(k, v []byte) error {
+			// An unreadable item has no result either; the runner fails it
+			var it item
+			if err := json.Unmarshal(v, &it); err != nil || it.Result == nil {
+				pending = append(pending, int(binary.BigEndian.Uint64(k)))
+			}
+			return nil
+		})
+	})
+	return pending, err
+}
+
+// Request returns the comment stored at index
+func (s *Store) Request(id string, index int) (*models.CommentRequest, error) {
+	var req *models.CommentRequest
+	err := s.db.View(func(tx *bolt.Tx) error {
+		it, err := getItem(tx, id, index)
+		if err != nil {
+			return err
+		}
+		req = it.Request
+		return nil
+	})
+	return req, err
+}
+
+// Record stores an item's result and counts it against the job in one transaction
+func (s *Store) Record(id string, result models.ItemResult) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		job, err := getJob(tx, id)
+		if err != nil {
+			return err
+		}
+		it, err := getItem(tx, id, result.Index)
+		if errors.Is(err, errCorruptItem) {
+			// The request is lost, but the result can still be kept
+			it, err = &item{}, nil
+		}
+		if err != nil {
+			return err
+		}
+		if it.Result != nil {
+			return nil
+		}
+
+		it.Result = &result
+		data, err := json.Marshal(it)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(itemsBucket).Bucket([]byte(id)).Put(indexKey(result.Index), data); err != nil {
+			return err
+		}
+
+		if result.Status == models.ItemSucceeded {
+			job.Succeeded++
+		} else {
+			job.Failed++
+		}
+		return putJob(tx, job)
+	})
+}
+
+// Results returns up to limit item results starting at offset. Items not yet
+// processed, or unreadable until the runner fails them, are reported as pending.
+func (s *Store) Results(id string, offset, limit int) ([]models.ItemResult, error) {
+	results := []models.ItemResult{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		items := tx.Bucket(itemsBucket).Bucket([]byte(id))
+		if items == nil {
+			return ErrNotFound
+		}
+
+		cursor := items.Cursor()
+		for k, v := cursor.Seek(indexKey(offset)); k != nil && len(results) < limit; k, v = cursor.Next() {
+			var it item
+			if err := json.Unmarshal(v, &it); err == nil && it.Result != nil {
+				results = append(results, *it.Result)
+				continue
+			}
+			results = append(results, models.ItemResult{
+				Index:  int(binary.BigEndian.Uint64(k)),
+				Status: models.ItemPending,
+			})
+		}
+		return nil
+	})
+	return results, err
+}
+
+// Purge deletes completed jobs that finished before cutoff
+func (s *Store) Purge(cutoff time.Time) (int, error) {
+	purged := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var expired [][]byte
+		err := tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var job models.Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := tx.Bucket(jobsBucket).Delete(k); err != nil {
+				return err
+			}
+			if err := tx.Bucket(itemsBucket).DeleteBucket(k); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func getJob(tx *bolt.Tx, id string) (*models.Job, error) {
+	data := tx.Bucket(jobsBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var job models.Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func putJob(tx *bolt.Tx, job *models.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+}
+
+func getItem(tx *bolt.Tx, id string, index int) (*item, error) {
+	items := tx.Bucket(itemsBucket).Bucket([]byte(id))
+	if items == nil {
+		return nil, ErrNotFound
+	}
+	data := items.Get(indexKey(index))
+	if data == nil {
+		return nil, fmt.Errorf("job %s has no item %d", id, index)
+	}
+	var it item
+	if err := json.Unmarshal(data, &it); err != nil {
+		return nil, fmt.Errorf("%w %d of job %s: %v", errCorruptItem, index, id, err)
+	}
+	return &it, nil
+}
+
+func indexKey(index int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(index))
+	return key
+}
+
+// IDs start with the creation time so bucket order is submission order, and
+// end with enough randomness that they can't be guessed
+func newID() string {
+	suffix := make([]byte, 16)
+	rand.Read(suffix)
+	return fmt.Sprintf("%012x%s", time.Now().UnixMilli(), hex.EncodeToString(suffix))
+}
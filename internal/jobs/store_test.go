@@ -0,0 +1,199 @@
+package jobs
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+func openTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jobs", "jobs.db")
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, path
+}
+
+func comments(texts ...string) []*models.CommentRequest {
+	requests := make([]*models.CommentRequest, len(texts))
+	for i, text := range texts {
+		requests[i] = &models.CommentRequest{Comment: text}
+	}
+	return requests
+}
+
+func TestStoreScopesJobsToTenant(t *testing.T) {
+	store, _ := openTestStore(t)
+
+	job, err := store.Create("acme", comments("hello"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if len(job.ID) != 44 {
+		t.Errorf("ID %q is %d characters, want 44", job.ID, len(job.ID))
+	}
+
+	tests := []struct {
+		tenant string
+		id     string
+		want   error
+	}{
+		{"acme", job.ID, nil},
+		{"globex", job.ID, ErrNotFound},
+		{"", job.ID, ErrNotFound},
+		{"acme", "missing", ErrNotFound},
+	}
+	for _, tt := range tests {
+		got, err := store.Get(tt.tenant, tt.id)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Get(%q, %q): %v, want %v", tt.tenant, tt.id, err, tt.want)
+		}
+		if err == nil && got.ID != job.ID {
+			t.Errorf("Get(%q, %q) returned job %s", tt.tenant, tt.id, got.ID)
+		}
+	}
+}
+
+func TestStoreLifecycle(t *testing.T) {
+	store, path := openTestStore(t)
+
+	job, err := store.Create("acme", comments("first", "second", "third"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if job.Status != models.JobQueued || job.Total != 3 {
+		t.Fatalf("new job %+v", job)
+	}
+
+	if _, err := store.Start(job.ID); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	req, err := store.Request(job.ID, 1)
+	if err != nil || req.Comment != "second" {
+		t.Fatalf("Request: %+v %v", req, err)
+	}
+
+	store.Record(job.ID, models.ItemResult{Index: 0, Status: models.ItemSucceeded})
+	store.Record(job.ID, models.ItemResult{Index: 2, Status: models.ItemFailed})
+	// A result is only recorded once, so a resumed job can't count an item twice
+	store.Record(job.ID, models.ItemResult{Index: 2, Status: models.ItemSucceeded})
+
+	pending, err := store.Pending(job.ID)
+	if err != nil || !reflect.DeepEqual(pending, []int{1}) {
+		t.Fatalf("Pending: %v %v, want [1]", pending, err)
+	}
+	job, _ = store.Get("acme", job.ID)
+	if job.Succeeded != 1 || job.Failed != 1 || job.Status != models.JobRunning {
+		t.Fatalf("job %+v, want 1 succeeded, 1 failed, running", job)
+	}
+
+	results, err := store.Results(job.ID, 1, 10)
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+	var statuses []string
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	if want := []string{models.ItemPending, models.ItemFailed}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("results from offset 1: %v, want %v", statuses, want)
+	}
+	if results, _ := store.Results(job.ID, 0, 1); len(results) != 1 || results[0].Index != 0 {
+		t.Errorf("first page: %+v", results)
+	}
+
+	// Unfinished jobs are picked up again after a restart
+	store.Close()
+	store, err = OpenStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	if ids, err := store.Unfinished(); err != nil || !reflect.DeepEqual(ids, []string{job.ID}) {
+		t.Fatalf("Unfinished: %v %v", ids, err)
+	}
+
+	store.Record(job.ID, models.ItemResult{Index: 1, Status: models.ItemSucceeded})
+	if job, err = store.Finish(job.ID); err != nil || job.FinishedAt == nil {
+		t.Fatalf("Finish: %+v %v", job, err)
+	}
+	if ids, _ := store.Unfinished(); len(ids) != 0 {
+		t.Errorf("Unfinished after finishing: %v", ids)
+	}
+
+	if n, _ := store.Purge(job.FinishedAt.Add(-time.Second)); n != 0 {
+		t.Errorf("purged %d jobs finished after the cutoff", n)
+	}
+	if n, err := store.Purge(time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Fatalf("Purge: %d %v, want 1", n, err)
+	}
+	if _, err := store.Get("acme", job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after purge: %v, want ErrNotFound", err)
+	}
+	if _, err := store.Results(job.ID, 0, 10); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Results after purge: %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreKeepsNullItems(t *testing.T) {
+	store, _ := openTestStore(t)
+
+	job, err := store.Create("acme", []*models.CommentRequest{nil})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// The runner fails a nil request instead of processing it
+	if req, err := store.Request(job.ID, 0); err != nil || req != nil {
+		t.Errorf("Request: %+v %v, want nil", req, err)
+	}
+}
+
+func TestStoreCorruptItem(t *testing.T) {
+	store, _ := openTestStore(t)
+	job, err := store.Create("acme", comments("first", "second"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	corrupt(t, store, job.ID, 1)
+
+	if pending, err := store.Pending(job.ID); err != nil || !reflect.DeepEqual(pending, []int{0, 1}) {
+		t.Fatalf("Pending: %v %v, want [0 1]", pending, err)
+	}
+	if _, err := store.Request(job.ID, 1); !errors.Is(err, errCorruptItem) {
+		t.Fatalf("Request: %v, want errCorruptItem", err)
+	}
+	if results, err := store.Results(job.ID, 0, 10); err != nil || len(results) != 2 || results[1].Status != models.ItemPending {
+		t.Fatalf("Results: %+v %v", results, err)
+	}
+
+	// The failure replaces the unreadable item
+	if err := store.Record(job.ID, models.ItemResult{Index: 1, Status: models.ItemFailed}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if pending, _ := store.Pending(job.ID); !reflect.DeepEqual(pending, []int{0}) {
+		t.Errorf("Pending after Record: %v, want [0]", pending)
+	}
+	if job, _ := store.Get("acme", job.ID); job.Failed != 1 {
+		t.Errorf("job %+v, want 1 failed", job)
+	}
+}
+
+// corrupt overwrites an item with bytes that aren't JSON
+func corrupt(t *testing.T, store *Store, id string, index int) {
+	t.Helper()
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(itemsBucket).Bucket([]byte(id)).Put(indexKey(index), []byte("{not json"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
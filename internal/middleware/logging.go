@@ -1,9 +1,14 @@
 package middleware
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
+    "net/http"
+    "strings"
     "time"
     "github.com/gin-gonic/gin"
     "github.com/sirupsen/logrus"
+    "github.com/harshaSenaratne/reword/internal/models"
 )
 
 // logs every request
@@ -90,4 +95,36 @@ func RateLimitMiddleware(requestsPerMinute int) gin.HandlerFunc {
         requests[clientIP] = append(requests[clientIP], now)
         c.Next()
     }
-}
\ No newline at end of file
+}
+
+// attributes requests to a tenant by API key (X-API-Key or a bearer token).
+// When keys are configured, any other key is rejected; without a key list every
+// key is its own tenant, billed to a fingerprint so the raw key never reaches
+// logs or reports, and metrics count them all under one label.
+func TenantMiddleware(tenants map[string]string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        key := c.GetHeader("X-API-Key")
+        if key == "" {
+            key = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+        }
+
+        if key != "" {
+            tenant, ok := tenants[key]
+            if !ok && len(tenants) > 0 {
+                c.AbortWithStatusJSON(http.StatusUnauthorized, models.ErrorResponse{
+                    Error:   "Unauthorized",
+                    Message: "Unknown API key",
+                    Code:    http.StatusUnauthorized,
+                })
+                return
+            }
+            if !ok {
+                sum := sha256.Sum256([]byte(key))
+                tenant = "key-" + hex.EncodeToString(sum[:])[:12]
+            }
+            c.Set("tenant", tenant)
+        }
+
+        c.Next()
+    }
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+    "encoding/json"
     "time"
 )
 
@@ -9,16 +10,225 @@ type CommentRequest struct {
     Comment   string `json:"comment" binding:"required"`
     Sentiment string `json:"sentiment,omitempty"`
     UserID    string `json:"user_id,omitempty"`
+    // Tenant is resolved from the caller's API key, never from the body
+    Tenant    string `json:"-"`
+    // History holds earlier turns of a live conversation, oldest first
+    History   []Message `json:"-"`
 }
 
 // ModeratedResponse - What client recieves
 type ModeratedResponse struct {
-    OriginalComment   string    `json:"original_comment"`
-    ModeratedInput    string    `json:"moderated_input,omitempty"` 
-    AssistantReply    string    `json:"assistant_reply"`
-    WasModified       bool      `json:"was_modified"`                 
-    ModerationReason  string    `json:"moderation_reason,omitempty"`
-    Timestamp         time.Time `json:"timestamp"`
+    OriginalComment   string              `json:"original_comment"`
+    ModeratedInput    string              `json:"moderated_input,omitempty"` 
+    AssistantReply    string              `json:"assistant_reply"`
+    WasModified       bool                `json:"was_modified"`                 
+    ModerationReason  string              `json:"moderation_reason,omitempty"`
+    Action            string              `json:"action"`
+    PolicyRule        string              `json:"policy_rule,omitempty"`
+    Toxicity          *ToxicityVerdict    `json:"toxicity,omitempty"`
+    Steps             map[string]StepInfo `json:"steps,omitempty"`
+    Degraded          bool                `json:"degraded,omitempty"`
+    SemanticReuse     bool                `json:"semantic_reuse,omitempty"`
+    Truncated         bool                `json:"truncated,omitempty"`
+    PII               []PIIFinding        `json:"pii,omitempty"`
+    Tokens            TokenUsage          `json:"tokens"`
+    CostUSD           float64             `json:"cost_usd"`
+    Timestamp         time.Time           `json:"timestamp"`
+}
+
+// Moderation actions a policy can choose
+const (
+    ActionAllow    = "allow"
+    ActionRewrite  = "rewrite"
+    ActionMask     = "mask"
+    ActionBlock    = "block"
+    ActionHold     = "hold"
+    ActionEscalate = "escalate"
+)
+
+// Chain step names used as keys in ModeratedResponse.Steps
+const (
+    StepPrefilter  = "prefilter"
+    StepToxicity   = "toxicity"
+    StepModeration = "moderation"
+    StepSentiment  = "sentiment"
+    StepReply      = "reply"
+)
+
+// Events sent by the streaming endpoint, in the order a chain run emits them
+const (
+    EventToxicity  = "toxicity"
+    EventDecision  = "decision"
+    EventModerated = "moderated"
+    EventSentiment = "sentiment"
+    EventToken     = "token"
+    EventReset     = "reset"
+    EventDone      = "done"
+    EventError     = "error"
+)
+
+// DecisionEvent - The policy's action for a streamed comment
+type DecisionEvent struct {
+    Action     string `json:"action"`
+    PolicyRule string `json:"policy_rule,omitempty"`
+}
+
+// ModeratedEvent - The comment the assistant will reply to
+type ModeratedEvent struct {
+    ModeratedInput string `json:"moderated_input"`
+    WasModified    bool   `json:"was_modified"`
+}
+
+// SentimentEvent - The sentiment the reply is written in
+type SentimentEvent struct {
+    Sentiment string `json:"sentiment"`
+}
+
+// TokenEvent - A chunk of the assistant reply
+type TokenEvent struct {
+    Text string `json:"text"`
+}
+
+// StepInfo - Which model produced a chain step, and whether it came from cache.
+// Similarity is set when the result was reused from a near-duplicate comment.
+// Tokens are what the step spent on this request, so cache hits report none.
+// Rule names the local rule that settled a step without a model.
+// Embedding is the call made to look the comment up in the semantic cache.
+type StepInfo struct {
+    Model      string      `json:"model"`
+    Rule       string      `json:"rule,omitempty"`
+    Fallback   bool        `json:"fallback,omitempty"`
+    Cached     bool        `json:"cached,omitempty"`
+    Similarity float64     `json:"similarity,omitempty"`
+    Tokens     *TokenUsage `json:"tokens,omitempty"`
+    CostUSD    float64     `json:"cost_usd,omitempty"`
+    Embedding  *StepInfo   `json:"embedding,omitempty"`
+}
+
+// TokenUsage - Prompt and completion tokens spent
+type TokenUsage struct {
+    Prompt     int `json:"prompt"`
+    Completion int `json:"completion"`
+    Total      int `json:"total"`
+}
+
+// Add sums two usages
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+    return TokenUsage{
+        Prompt:     u.Prompt + other.Prompt,
+        Completion: u.Completion + other.Completion,
+        Total:      u.Total + other.Total,
+    }
+}
+
+// ToxicityCategories every comment is scored against
+var ToxicityCategories = []string{
+    "harassment",
+    "hate",
+    "threat",
+    "sexual",
+    "self_harm",
+    "spam",
+    "profanity",
+}
+
+// IsToxicityCategory reports whether category is one of ToxicityCategories
+func IsToxicityCategory(category string) bool {
+    for _, known := range ToxicityCategories {
+        if category == known {
+            return true
+        }
+    }
+    return false
+}
+
+// Toxicity verdict values
+const (
+    VerdictToxic = "toxic"
+    VerdictClean = "clean"
+)
+
+// ToxicityVerdict - Structured result of the toxicity check, with a 0-1 score
+// per category (harassment, hate, threat, sexual, self_harm, spam, profanity)
+type ToxicityVerdict struct {
+    Verdict    string             `json:"verdict"`
+    Scores     map[string]float64 `json:"scores"`
+    Categories []string           `json:"categories"`
+    Confidence float64            `json:"confidence"`
+    Reason     string             `json:"reason"`
+    Spans      []FlaggedSpan      `json:"spans,omitempty"`
+}
+
+// FlaggedSpan - Part of the comment as the user wrote it that a rule matched.
+// Start and End count characters (code points), End exclusive.
+type FlaggedSpan struct {
+    Start int    `json:"start"`
+    End   int    `json:"end"`
+    Text  string `json:"text"`
+    Rule  string `json:"rule"`
+}
+
+// Kinds of personal data redacted before a comment is sent to a model
+const (
+    PIIEmail   = "email"
+    PIIPhone   = "phone"
+    PIICard    = "card"
+    PIIIBAN    = "iban"
+    PIIAddress = "address"
+    PIIIP      = "ip"
+)
+
+// PIITypes lists every kind of personal data that can be detected
+var PIITypes = []string{PIIEmail, PIIPhone, PIICard, PIIIBAN, PIIAddress, PIIIP}
+
+// IsPIIType reports whether kind is one of PIITypes
+func IsPIIType(kind string) bool {
+    for _, known := range PIITypes {
+        if kind == known {
+            return true
+        }
+    }
+    return false
+}
+
+// What becomes of redacted personal data in rewrites and replies
+const (
+    PIIRestore = "restore"
+    PIIRedact  = "redact"
+)
+
+// PIIFinding - Personal data found in the comment and replaced with
+// Placeholder before any model saw it. Start and End count characters
+// (code points) of the original comment, End exclusive. The value itself is
+// never reported.
+type PIIFinding struct {
+    Type        string `json:"type"`
+    Start       int    `json:"start"`
+    End         int    `json:"end"`
+    Placeholder string `json:"placeholder"`
+    // Handling is restore or redact, per policy
+    Handling    string `json:"handling"`
+}
+
+// IsToxic reports whether the verdict flags the comment
+func (v *ToxicityVerdict) IsToxic() bool {
+    return v != nil && v.Verdict == VerdictToxic
+}
+
+// Score returns the score for a category, 0 when unknown
+func (v *ToxicityVerdict) Score(category string) float64 {
+    if v == nil {
+        return 0
+    }
+    return v.Scores[category]
+}
+
+// TopCategory returns the highest scoring category and its score
+func (v *ToxicityVerdict) TopCategory() (string, float64) {
+    if v == nil || len(v.Categories) == 0 {
+        return "", 0
+    }
+    return v.Categories[0], v.Scores[v.Categories[0]]
 }
 
 // ModerationContext - Additional context for moderation
@@ -28,6 +238,12 @@ type ModerationContext struct {
     PreviousContext []Message
 }
 
+// Message roles
+const (
+    RoleUser      = "user"
+    RoleAssistant = "assistant"
+)
+
 // Message - Single message in conversation
 type Message struct {
     Role      string    `json:"role"`
@@ -35,11 +251,170 @@ type Message struct {
     Timestamp time.Time `json:"timestamp"`
 }
 
+// ChatMessage - What a live chat client sends over the WebSocket
+type ChatMessage struct {
+    ID        string `json:"id,omitempty"`
+    Comment   string `json:"comment"`
+    Sentiment string `json:"sentiment,omitempty"`
+    UserID    string `json:"user_id,omitempty"`
+}
+
+// Chat event types
+const (
+    ChatReady  = "ready"
+    ChatResult = "result"
+    ChatError  = "error"
+)
+
+// ChatEvent - What the server pushes back; ID echoes the message it answers
+type ChatEvent struct {
+    Type           string             `json:"type"`
+    ID             string             `json:"id,omitempty"`
+    ConversationID string             `json:"conversation_id,omitempty"`
+    Response       *ModeratedResponse `json:"response,omitempty"`
+    Error          *ErrorResponse     `json:"error,omitempty"`
+    RetryAfter     int                `json:"retry_after,omitempty"`
+}
+
+// Job statuses
+const (
+    JobQueued    = "queued"
+    JobRunning   = "running"
+    JobCompleted = "completed"
+)
+
+// Item statuses within a batch or job
+const (
+    ItemPending   = "pending"
+    ItemSucceeded = "succeeded"
+    ItemFailed    = "failed"
+    ItemCancelled = "cancelled"
+)
+
+// BatchResponse - Per-item results of a synchronous batch, in request order
+type BatchResponse struct {
+    Results   []ItemResult `json:"results"`
+    Count     int          `json:"count"`
+    Succeeded int          `json:"succeeded"`
+    Failed    int          `json:"failed"`
+    Cancelled int          `json:"cancelled"`
+}
+
+// JobRequest - Comments submitted for asynchronous moderation
+type JobRequest struct {
+    Items []*CommentRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+// Job - Progress of an asynchronous batch
+type Job struct {
+    ID         string     `json:"id"`
+    Status     string     `json:"status"`
+    Total      int        `json:"total"`
+    Succeeded  int        `json:"succeeded"`
+    Failed     int        `json:"failed"`
+    Tenant     string     `json:"tenant,omitempty"`
+    CreatedAt  time.Time  `json:"created_at"`
+    StartedAt  *time.Time `json:"started_at,omitempty"`
+    FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ItemResult - The outcome for one comment of a batch: a response or an error
+type ItemResult struct {
+    Index    int                `json:"index"`
+    Status   string             `json:"status"`
+    Response *ModeratedResponse `json:"response,omitempty"`
+    Error    *ErrorResponse     `json:"error,omitempty"`
+}
+
+// JobResults - A page of a job's item results
+type JobResults struct {
+    JobID  string       `json:"job_id"`
+    Offset int          `json:"offset"`
+    Limit  int          `json:"limit"`
+    Total  int          `json:"total"`
+    Items  []ItemResult `json:"items"`
+}
+
+// Webhook event types
+const (
+    WebhookCommentRewritten = "comment.rewritten"
+    WebhookCommentBlocked   = "comment.blocked"
+    WebhookEscalationRaised = "escalation.raised"
+    WebhookJobCompleted     = "job.completed"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{
+    WebhookCommentRewritten,
+    WebhookCommentBlocked,
+    WebhookEscalationRaised,
+    WebhookJobCompleted,
+}
+
+// WebhookRequest - A webhook registration; no events means all of them
+type WebhookRequest struct {
+    URL    string   `json:"url" binding:"required,url"`
+    Events []string `json:"events,omitempty" binding:"dive,oneof=comment.rewritten comment.blocked escalation.raised job.completed"`
+}
+
+// Webhook - A registered endpoint. The secret is only shown when it is created.
+type Webhook struct {
+    ID        string    `json:"id"`
+    URL       string    `json:"url"`
+    Events    []string  `json:"events"`
+    Secret    string    `json:"secret,omitempty"`
+    Tenant    string    `json:"-"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery statuses
+const (
+    DeliveryPending   = "pending"
+    DeliveryDelivered = "delivered"
+    DeliveryFailed    = "failed"
+)
+
+// WebhookEvent - The body POSTed to a webhook
+type WebhookEvent struct {
+    ID        string    `json:"id"`
+    Type      string    `json:"type"`
+    CreatedAt time.Time `json:"created_at"`
+    Data      any       `json:"data"`
+}
+
+// CommentEvent - Data of the comment.* and escalation.raised events
+type CommentEvent struct {
+    UserID           string           `json:"user_id,omitempty"`
+    OriginalComment  string           `json:"original_comment"`
+    ModeratedInput   string           `json:"moderated_input,omitempty"`
+    Action           string           `json:"action"`
+    PolicyRule       string           `json:"policy_rule,omitempty"`
+    ModerationReason string           `json:"moderation_reason,omitempty"`
+    Toxicity         *ToxicityVerdict `json:"toxicity,omitempty"`
+}
+
+// WebhookDelivery - One attempt history of sending an event to a webhook
+type WebhookDelivery struct {
+    ID            string          `json:"id"`
+    WebhookID     string          `json:"webhook_id"`
+    Event         string          `json:"event"`
+    Status        string          `json:"status"`
+    Attempts      int             `json:"attempts"`
+    ResponseCode  int             `json:"response_code,omitempty"`
+    LastError     string          `json:"last_error,omitempty"`
+    ReplayOf      string          `json:"replay_of,omitempty"`
+    Payload       json.RawMessage `json:"payload"`
+    CreatedAt     time.Time       `json:"created_at"`
+    NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+    DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
+
 // HealthResponse - Server health check
 type HealthResponse struct {
-    Status    string    `json:"status"`
-    Version   string    `json:"version"`
-    Timestamp time.Time `json:"timestamp"`
+    Status    string            `json:"status"`
+    Version   string            `json:"version"`
+    Circuits  map[string]string `json:"circuits,omitempty"`
+    Timestamp time.Time         `json:"timestamp"`
 }
 
 // ErrorResponse - Standardized error format
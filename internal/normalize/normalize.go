@@ -0,0 +1,399 @@
+// Package normalize undoes the tricks used to slip text past moderation:
+// invisible characters, look-alike letters from other scripts, leetspeak,
+// spaced-out words and stretched letters. Every character of the result
+// remembers the span of the original text it came from, so whatever is
+// flagged in the normalized text can be reported against what the user wrote.
+package normalize
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Options picks the steps Apply runs. They always run in the order listed.
+type Options struct {
+	// Invisible drops zero-width and other format characters (soft hyphens,
+	// direction marks, tags) and variation selectors. It also folds
+	// compatibility forms, so fullwidth and styled letters become plain ones,
+	// and strips accents and stacked marks from Latin, Greek and Cyrillic.
+	Invisible bool `yaml:"invisible"`
+	Lowercase bool `yaml:"lowercase"`
+	// Homoglyphs maps Cyrillic and Greek look-alikes to Latin letters
+	Homoglyphs bool `yaml:"homoglyphs"`
+	// Spacing joins three or more single letters split by spaces or
+	// punctuation ("k i l l", "k.i.l.l")
+	Spacing bool `yaml:"spacing"`
+	// Leetspeak reads digits and symbols inside words as letters ("1d10t")
+	Leetspeak bool `yaml:"leetspeak"`
+	// Runs of one letter longer than MaxRepeat are cut to MaxRepeat letters
+	// ("stuuupid" is "stuupid" at 2); 0 leaves them alone
+	MaxRepeat int `yaml:"max_repeat"`
+	// StripPunctuation turns punctuation and symbols into word breaks and
+	// drops apostrophes
+	StripPunctuation bool `yaml:"strip_punctuation"`
+}
+
+// Default undoes obfuscation but keeps case and punctuation, so the result
+// still reads naturally to a model. Leetspeak is left off: it can't tell
+// "1d10t" from "mp3s" or "i18n", and a model reads leetspeak well enough.
+func Default() Options {
+	return Options{
+		Invisible:  true,
+		Homoglyphs: true,
+		Spacing:    true,
+		MaxRepeat:  2,
+	}
+}
+
+// Text is a normalized string with a map back to the original
+type Text struct {
+	Original   string
+	Normalized string
+	// original byte span of the character behind each normalized byte
+	starts, ends []int
+}
+
+// unit is one character of the text being normalized and the original span it stands for
+type unit struct {
+	r          rune
+	start, end int
+}
+
+// Apply normalizes text. Whitespace is always collapsed and trimmed.
+func Apply(text string, opts Options) *Text {
+	units := decode(text, opts.Invisible)
+	if opts.Lowercase {
+		for i := range units {
+			units[i].r = unicode.ToLower(units[i].r)
+		}
+	}
+	if opts.Homoglyphs {
+		mapHomoglyphs(units)
+	}
+	if opts.Spacing {
+		units = joinSpaced(units)
+	}
+	if opts.Leetspeak {
+		readLeet(units)
+	}
+	if opts.MaxRepeat > 0 {
+		units = squeeze(units, opts.MaxRepeat)
+	}
+	if opts.StripPunctuation {
+		units = stripPunctuation(units)
+	}
+	return build(text, collapseSpace(units))
+}
+
+// Span maps a byte range of the normalized text to the byte range of the
+// original text it came from
+func (t *Text) Span(start, end int) (int, int) {
+	if start >= end || start >= len(t.starts) {
+		return len(t.Original), len(t.Original)
+	}
+	if end > len(t.ends) {
+		end = len(t.ends)
+	}
+	return t.starts[start], t.ends[end-1]
+}
+
+// Changed reports whether normalization altered anything beyond whitespace
+func (t *Text) Changed() bool {
+	return t.Normalized != strings.Join(strings.Fields(t.Original), " ")
+}
+
+func decode(text string, invisible bool) []unit {
+	units := make([]unit, 0, len(text))
+	// whether combining marks here sit on a Latin, Greek or Cyrillic letter;
+	// marks that other scripts need to be read correctly are kept
+	strip := false
+	for i, r := range text {
+		end := i + utf8.RuneLen(r)
+		if r == utf8.RuneError {
+			end = i + 1
+		}
+		if !invisible {
+			units = append(units, unit{r, i, end})
+			continue
+		}
+
+		var kept []rune
+		for _, d := range norm.NFKD.String(string(r)) {
+			switch {
+			case unicode.In(d, unicode.Cf, unicode.Variation_Selector):
+				continue
+			case unicode.In(d, unicode.Mn, unicode.Me):
+				if strip {
+					continue
+				}
+			default:
+				strip = unicode.In(d, unicode.Latin, unicode.Greek, unicode.Cyrillic, unicode.Common)
+			}
+			kept = append(kept, d)
+		}
+		// Recompose whatever was decomposed and kept, such as Hangul syllables
+		for _, c := range norm.NFC.String(string(kept)) {
+			units = append(units, unit{c, i, end})
+		}
+	}
+	return units
+}
+
+// maps look-alike letters in words that mix them with Latin ones, and in
+// words made only of look-alikes when the text is mostly Latin. Text really
+// written in Cyrillic or Greek is left alone.
+func mapHomoglyphs(units []unit) {
+	latin, other := 0, 0
+	for _, u := range units {
+		switch {
+		case unicode.Is(unicode.Latin, u.r):
+			latin++
+		case unicode.In(u.r, unicode.Greek, unicode.Cyrillic):
+			other++
+		}
+	}
+
+	for i := 0; i < len(units); {
+		if !unicode.IsLetter(units[i].r) {
+			i++
+			continue
+		}
+		end := i
+		hasLatin, mappable := false, true
+		for end < len(units) && unicode.IsLetter(units[end].r) {
+			if unicode.Is(unicode.Latin, units[end].r) {
+				hasLatin = true
+			} else if _, ok := homoglyphs[units[end].r]; !ok {
+				mappable = false
+			}
+			end++
+		}
+		if hasLatin || (mappable && latin > other) {
+			for k := i; k < end; k++ {
+				if r, ok := homoglyphs[units[k].r]; ok {
+					units[k].r = r
+				}
+			}
+		}
+		i = end
+	}
+}
+
+// joins runs of at least three single letters split by short separators.
+// Leet characters count as letters here, but a run needs two real ones so
+// "1 2 3" stays put.
+func joinSpaced(units []unit) []unit {
+	out := make([]unit, 0, len(units))
+	for i := 0; i < len(units); {
+		if !isSingle(units, i) {
+			out = append(out, units[i])
+			i++
+			continue
+		}
+
+		letters := []int{i}
+		next := i + 1
+		for {
+			j := next
+			for j < len(units) && j-next < 3 && isSeparator(units[j].r) {
+				j++
+			}
+			if j == next || !isSingle(units, j) {
+				break
+			}
+			letters = append(letters, j)
+			next = j + 1
+		}
+
+		letterCount := 0
+		for _, k := range letters {
+			if unicode.IsLetter(units[k].r) {
+				letterCount++
+			}
+		}
+		if len(letters) < 3 || letterCount < 2 {
+			out = append(out, units[i])
+			i++
+			continue
+		}
+		for _, k := range letters {
+			out = append(out, units[k])
+		}
+		i = next
+	}
+	return out
+}
+
+// a letter or leet character standing on its own
+func isSingle(units []unit, i int) bool {
+	if i >= len(units) || !isWordRune(units[i].r) {
+		return false
+	}
+	before := i == 0 || !isWordRune(units[i-1].r)
+	after := i+1 == len(units) || !isWordRune(units[i+1].r)
+	return before && after
+}
+
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(".-_*·", r)
+}
+
+func isWordRune(r rune) bool {
+	_, leet := leet[r]
+	return unicode.IsLetter(r) || leet
+}
+
+// reads leet characters as letters inside words that have real letters too.
+// Trailing digits and symbols are left alone, as are ordinals, so "mp3",
+// "covid19", "1st" and "great!" survive.
+func readLeet(units []unit) {
+	for i := 0; i < len(units); {
+		if !isWordRune(units[i].r) {
+			i++
+			continue
+		}
+		end := i
+		for end < len(units) && isWordRune(units[end].r) {
+			end++
+		}
+		word := units[i:end]
+
+		last := -1
+		for k := range word {
+			if unicode.IsLetter(word[k].r) {
+				last = k
+			}
+		}
+		if last >= 0 && !isOrdinal(word) {
+			for k := 0; k < last; k++ {
+				if letter, ok := leet[word[k].r]; ok {
+					word[k].r = letter
+				}
+			}
+		}
+		i = end
+	}
+}
+
+func isOrdinal(word []unit) bool {
+	var b strings.Builder
+	for _, u := range word {
+		b.WriteRune(unicode.ToLower(u.r))
+	}
+	s := b.String()
+	digits := strings.TrimRight(s, "stndrh")
+	if digits == "" || len(s)-len(digits) != 2 {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	switch s[len(digits):] {
+	case "st", "nd", "rd", "th":
+		return true
+	}
+	return false
+}
+
+// cuts runs of one letter longer than max down to max letters, the last of
+// them spanning the rest of the run
+func squeeze(units []unit, max int) []unit {
+	out := make([]unit, 0, len(units))
+	for i := 0; i < len(units); {
+		j := i + 1
+		for j < len(units) && unicode.IsLetter(units[i].r) && unicode.ToLower(units[j].r) == unicode.ToLower(units[i].r) {
+			j++
+		}
+		if j-i > max {
+			out = append(out, units[i:i+max-1]...)
+			last := units[i+max-1]
+			out = append(out, unit{last.r, last.start, units[j-1].end})
+		} else {
+			out = append(out, units[i:j]...)
+		}
+		i = j
+	}
+	return out
+}
+
+func stripPunctuation(units []unit) []unit {
+	out := units[:0]
+	for _, u := range units {
+		switch {
+		case u.r == '\'' || u.r == '’':
+			continue
+		case unicode.IsLetter(u.r) || unicode.IsNumber(u.r) || unicode.IsSpace(u.r):
+		default:
+			u.r = ' '
+		}
+		out = append(out, u)
+	}
+	return out
+}
+
+func collapseSpace(units []unit) []unit {
+	out := units[:0]
+	for _, u := range units {
+		if unicode.IsSpace(u.r) {
+			if len(out) == 0 || out[len(out)-1].r == ' ' {
+				continue
+			}
+			u.r = ' '
+		}
+		out = append(out, u)
+	}
+	if len(out) > 0 && out[len(out)-1].r == ' ' {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+func build(original string, units []unit) *Text {
+	var b strings.Builder
+	t := &Text{Original: original}
+	for _, u := range units {
+		n, _ := b.WriteRune(u.r)
+		for k := 0; k < n; k++ {
+			t.starts = append(t.starts, u.start)
+			t.ends = append(t.ends, u.end)
+		}
+	}
+	t.Normalized = b.String()
+	return t
+}
+
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'9': 'g',
+	'@': 'a',
+	'$': 's',
+	'!': 'i',
+	'|': 'l',
+	'€': 'e',
+}
+
+// Cyrillic and Greek letters that render like Latin ones
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i',
+	'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'г': 'r',
+	'ѕ': 's', 'т': 't', 'ѵ': 'v', 'ԝ': 'w', 'х': 'x', 'у': 'y',
+	'А': 'A', 'В': 'B', 'С': 'C', 'Е': 'E', 'Ё': 'E', 'Н': 'H', 'І': 'I', 'Ї': 'I', 'Ј': 'J',
+	'К': 'K', 'М': 'M', 'О': 'O', 'Р': 'P', 'Ѕ': 'S', 'Т': 'T', 'Х': 'X', 'У': 'Y', 'Ԝ': 'W',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N',
+	'Ο': 'O', 'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+}
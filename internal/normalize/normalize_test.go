@@ -0,0 +1,114 @@
+package normalize
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyDefault(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"leetspeak is left alone", "you 1d10t", "you 1d10t"},
+		{"digits inside words are kept", "mp3s and i18n", "mp3s and i18n"},
+		{"trailing digits are kept", "mp3 and covid19", "mp3 and covid19"},
+		{"numbers stay numbers", "I have 10 apples", "I have 10 apples"},
+		{"ordinals stay ordinals", "came 1st and 2nd", "came 1st and 2nd"},
+		{"cyrillic homoglyphs", "so ѕtupіd", "so stupid"},
+		{"zero-width characters", "stu\u200bpid", "stupid"},
+		{"fullwidth letters", "ｉｄｉｏｔ", "idiot"},
+		{"accents", "café crème", "cafe creme"},
+		{"spaced letters", "you k i l l", "you kill"},
+		{"dotted letters", "s.t.u.p.i.d", "stupid"},
+		{"stretched letters", "stuuuupid", "stuupid"},
+		{"stretched doubled letters", "goooood", "good"},
+		{"stretched letters keep two", "coool", "cool"},
+		{"doubled letters are kept", "good book", "good book"},
+		{"punctuation is kept", "thank you!!", "thank you!!"},
+		{"case is kept", "Hello There", "Hello There"},
+		{"other scripts are left alone", "Привет, как дела?", "Привет, как дела?"},
+		{"whitespace collapses", "  many   spaces\n", "many spaces"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := Apply(tt.in, Default())
+			if text.Normalized != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.in, text.Normalized, tt.want)
+			}
+			if changed := tt.want != strings.Join(strings.Fields(tt.in), " "); text.Changed() != changed {
+				t.Errorf("Changed() = %v, want %v", text.Changed(), changed)
+			}
+		})
+	}
+}
+
+func TestApplyOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		in   string
+		want string
+	}{
+		{"nothing enabled", Options{}, "Y0u  1d10t!!", "Y0u 1d10t!!"},
+		{"lowercase", Options{Lowercase: true}, "SHOUTING", "shouting"},
+		{"strip punctuation", Options{StripPunctuation: true}, "don't...stop!", "dont stop"},
+		{"leetspeak", Options{Leetspeak: true}, "you 1d10t", "you idiot"},
+		{"leetspeak words", Options{Leetspeak: true}, "y0u l0$er", "you loser"},
+		{"leetspeak keeps trailing digits", Options{Leetspeak: true}, "mp3 and covid19", "mp3 and covid19"},
+		{"leetspeak without homoglyphs", Options{Leetspeak: true}, "ѕtup1d", "ѕtupid"},
+		{"max repeat 1", Options{MaxRepeat: 1}, "goooood", "god"},
+		{"max repeat 3", Options{MaxRepeat: 3}, "sooo good, soooo good", "sooo good, sooo good"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Apply(tt.in, tt.opts).Normalized; got != tt.want {
+				t.Errorf("Apply(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpan(t *testing.T) {
+	opts := Default()
+	opts.Lowercase = true
+	opts.Leetspeak = true
+	opts.StripPunctuation = true
+
+	tests := []struct {
+		name     string
+		in       string
+		word     string
+		original string
+	}{
+		{"leetspeak", "You are a 1D10T!", "idiot", "1D10T"},
+		{"homoglyphs", "Wow, ѕtupіd idea", "stupid", "ѕtupіd"},
+		{"zero-width characters", "a stu\u200bpid take", "stupid", "stu\u200bpid"},
+		{"spaced letters", "I will k i l l you", "kill", "k i l l"},
+		{"stretched letters", "stuuuupid!!", "stuupid", "stuuuupid"},
+		{"phrase", "I'm   going to hurt you", "im going to hurt you", "I'm   going to hurt you"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := Apply(tt.in, opts)
+			at := strings.Index(text.Normalized, tt.word)
+			if at < 0 {
+				t.Fatalf("%q not found in %q", tt.word, text.Normalized)
+			}
+			start, end := text.Span(at, at+len(tt.word))
+			if got := tt.in[start:end]; got != tt.original {
+				t.Errorf("span %d-%d is %q, want %q", start, end, got, tt.original)
+			}
+		})
+	}
+
+	// Empty and out of range spans point at the end of the original
+	text := Apply("hello", opts)
+	for _, span := range [][2]int{{2, 2}, {10, 12}} {
+		if start, end := text.Span(span[0], span[1]); start != 5 || end != 5 {
+			t.Errorf("Span(%d, %d) = %d, %d, want 5, 5", span[0], span[1], start, end)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Package pii finds personal data in text and swaps it for placeholders, so a
+// comment can be sent to a model provider without the values in it. What the
+// model writes back can then have the values put back in, or left out.
+package pii
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	ibanPattern  = regexp.MustCompile(`\b[A-Z]{2}[0-9]{2}(?: ?[A-Z0-9]){11,30}\b`)
+	cardPattern  = regexp.MustCompile(`\b(?:[0-9][ -]?){12,18}[0-9]\b`)
+	ipv4Pattern  = regexp.MustCompile(`\b(?:[0-9]{1,3}\.){3}[0-9]{1,3}\b`)
+	ipv6Pattern  = regexp.MustCompile(`(?i)\b(?:[0-9a-f]{0,4}:){2,7}[0-9a-f]{0,4}\b`)
+	datePattern  = regexp.MustCompile(`\b[0-9]{4}-[0-9]{2}-[0-9]{2}\b`)
+	phonePattern = regexp.MustCompile(`(?:\+[0-9]{1,3}[ .-]?)?(?:\([0-9]{1,4}\)[ .-]?)?[0-9]{2,5}(?:[ .-]?[0-9]{2,5}){1,4}`)
+	// A house number and a capitalised street name ending in a street type
+	addressPattern = regexp.MustCompile(`\b[0-9]{1,5}[A-Za-z]?(?: [A-Z][A-Za-z'.-]*){1,4} (?i:street|st|avenue|ave|road|rd|boulevard|blvd|lane|ln|drive|dr|court|ct|way|place|pl|terrace|parkway|pkwy|square|sq|close|crescent|highway|hwy)\b\.?`)
+
+	placeholderPattern = regexp.MustCompile(`\[([A-Z]+)_([0-9]+)\]`)
+	// The start of a placeholder cut off at the end of a text
+	partialPattern = regexp.MustCompile(`\[[A-Z]*(?:_[0-9]*)?$`)
+)
+
+// maxPlaceholder is the longest placeholder Redact writes, "[ADDRESS_999]" and up
+const maxPlaceholder = 16
+
+// detector finds candidate spans of one kind of personal data; check rejects
+// candidates that only look the part
+type detector struct {
+	kind    string
+	pattern *regexp.Regexp
+	check   func(text string, start, end int) (int, int, bool)
+}
+
+// Tried in order; a span already taken by an earlier kind is skipped, so an
+// IBAN is never also read as a phone number
+var detectors = []detector{
+	{models.PIIEmail, emailPattern, whole},
+	{models.PIIIBAN, ibanPattern, checkIBAN},
+	{models.PIICard, cardPattern, checkCard},
+	{models.PIIIP, ipv4Pattern, checkIP},
+	{models.PIIIP, ipv6Pattern, checkIPv6},
+	{models.PIIPhone, phonePattern, checkPhone},
+	{models.PIIAddress, addressPattern, whole},
+}
+
+// Detector redacts the kinds of personal data it was built for. A nil
+// Detector finds nothing.
+type Detector struct {
+	types map[string]bool
+}
+
+// New returns a detector for the given kinds, or for every kind when none are given
+func New(types []string) (*Detector, error) {
+	if len(types) == 0 {
+		types = models.PIITypes
+	}
+	d := &Detector{types: make(map[string]bool, len(types))}
+	for _, kind := range types {
+		if !models.IsPIIType(kind) {
+			return nil, fmt.Errorf("unknown PII type %q", kind)
+		}
+		d.types[kind] = true
+	}
+	return d, nil
+}
+
+// Redaction is a text with its personal data replaced by placeholders such as
+// "[EMAIL_1]". The same value always gets the same placeholder.
+type Redaction struct {
+	Original string
+	Text     string
+	// Findings in the order they appear in Original; Handling is left empty
+	Findings []models.PIIFinding
+
+	detector *Detector
+	values   map[string]string
+	kinds    map[string]string
+	issued   map[string]string
+	counts   map[string]int
+}
+
+// Redact replaces the personal data in text with placeholders
+func (d *Detector) Redact(text string) *Redaction {
+	r := &Redaction{
+		Original: text,
+		detector: d,
+		values:   make(map[string]string),
+		kinds:    make(map[string]string),
+		issued:   make(map[string]string),
+		counts:   make(map[string]int),
+	}
+	r.Text = r.redact(text, true)
+	return r
+}
+
+// Also redacts another text, such as an earlier turn of the conversation,
+// sharing placeholders with the first. Its findings aren't reported.
+func (r *Redaction) Also(text string) string {
+	return r.redact(text, false)
+}
+
+// Restore puts values back in place of their placeholders where restore
+// returns true for the value's kind. Other placeholders become "[EMAIL]" and
+// the like, so nothing can be traced back to a value.
+func (r *Redaction) Restore(text string, restore func(kind string) bool) string {
+	if len(r.values) == 0 {
+		return text
+	}
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		value, ok := r.values[placeholder]
+		if !ok {
+			return placeholder
+		}
+		kind := r.kinds[placeholder]
+		if restore(kind) {
+			return value
+		}
+		return "[" + strings.ToUpper(kind) + "]"
+	})
+}
+
+// TrimPartial drops the start of a placeholder left at the end of a text
+// that was cut short, so "[EMAIL_1]" never reaches a model as "[EMA"
+func TrimPartial(text string) string {
+	if loc := partialPattern.FindStringIndex(text); loc != nil {
+		return text[:loc[0]]
+	}
+	return text
+}
+
+// Restorer restores text that arrives in chunks, holding back the end of a
+// chunk that may be the start of a placeholder until the rest arrives
+type Restorer struct {
+	redaction *Redaction
+	restore   func(kind string) bool
+	pending   string
+}
+
+// Restorer returns a Restorer that applies Restore to a chunked text
+func (r *Redaction) Restorer(restore func(kind string) bool) *Restorer {
+	return &Restorer{redaction: r, restore: restore}
+}
+
+// Write returns the part of the text so far that can be restored already
+func (w *Restorer) Write(chunk string) string {
+	w.pending += chunk
+	cut := len(w.pending)
+	if open := strings.LastIndexByte(w.pending, '['); open >= 0 && len(w.pending)-open < maxPlaceholder && !strings.Contains(w.pending[open:], "]") {
+		cut = open
+	}
+	ready := w.pending[:cut]
+	w.pending = w.pending[cut:]
+	return w.redaction.Restore(ready, w.restore)
+}
+
+// Flush returns whatever is still held back
+func (w *Restorer) Flush() string {
+	rest := w.pending
+	w.pending = ""
+	return w.redaction.Restore(rest, w.restore)
+}
+
+// Reset drops whatever is held back, for a text that starts over
+func (w *Restorer) Reset() {
+	w.pending = ""
+}
+
+type span struct {
+	kind       string
+	start, end int
+}
+
+func (r *Redaction) redact(text string, report bool) string {
+	if r.detector == nil {
+		return text
+	}
+
+	spans := r.detector.find(text)
+	if len(spans) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, s := range spans {
+		placeholder := r.placeholder(s.kind, text[s.start:s.end])
+		b.WriteString(text[last:s.start])
+		b.WriteString(placeholder)
+		last = s.end
+
+		if report {
+			r.Findings = append(r.Findings, models.PIIFinding{
+				Type:        s.kind,
+				Start:       utf8.RuneCountInString(text[:s.start]),
+				End:         utf8.RuneCountInString(text[:s.end]),
+				Placeholder: placeholder,
+			})
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (r *Redaction) placeholder(kind, value string) string {
+	key := kind + "\x00" + value
+	if placeholder, ok := r.issued[key]; ok {
+		return placeholder
+	}
+	r.counts[kind]++
+	placeholder := "[" + strings.ToUpper(kind) + "_" + strconv.Itoa(r.counts[kind]) + "]"
+	r.issued[key] = placeholder
+	r.values[placeholder] = value
+	r.kinds[placeholder] = kind
+	return placeholder
+}
+
+// finds every span of personal data, without overlaps, in order
+func (d *Detector) find(text string) []span {
+	var spans []span
+	for _, det := range detectors {
+		if !d.types[det.kind] {
+			continue
+		}
+		for _, loc := range det.pattern.FindAllStringIndex(text, -1) {
+			start, end, ok := det.check(text, loc[0], loc[1])
+			if ok && !overlaps(spans, start, end) {
+				spans = append(spans, span{det.kind, start, end})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	return spans
+}
+
+func overlaps(spans []span, start, end int) bool {
+	for _, s := range spans {
+		if start < s.end && s.start < end {
+			return true
+		}
+	}
+	return false
+}
+
+func whole(_ string, start, end int) (int, int, bool) {
+	return start, end, true
+}
+
+// card numbers pass the Luhn check
+func checkCard(text string, start, end int) (int, int, bool) {
+	digits := digitsOf(text[start:end])
+	if len(digits) < 13 || len(digits) > 19 {
+		return 0, 0, false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		n := int(digits[i] - '0')
+		if (len(digits)-i)%2 == 0 {
+			n *= 2
+			if n > 9 {
+				n -= 9
+			}
+		}
+		sum += n
+	}
+	return start, end, sum%10 == 0
+}
+
+// IBANs pass the ISO 13616 mod 97 check. The pattern may run on into
+// trailing capitalised words, so groups are dropped from the end until the
+// check passes.
+func checkIBAN(text string, start, end int) (int, int, bool) {
+	for {
+		candidate := strings.ReplaceAll(text[start:end], " ", "")
+		if len(candidate) < 15 {
+			return 0, 0, false
+		}
+		if len(candidate) <= 34 && ibanValid(candidate) {
+			return start, end, true
+		}
+		space := strings.LastIndexByte(text[start:end], ' ')
+		if space < 0 {
+			return 0, 0, false
+		}
+		end = start + space
+	}
+}
+
+func ibanValid(iban string) bool {
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+func checkIP(text string, start, end int) (int, int, bool) {
+	// Not part of a longer dotted number such as a version string
+	if start > 0 && text[start-1] == '.' || end < len(text) && text[end] == '.' && end+1 < len(text) && isDigit(text[end+1]) {
+		return 0, 0, false
+	}
+	return start, end, net.ParseIP(text[start:end]) != nil
+}
+
+// an address needs two groups with digits in them, so "::" in "std::vector"
+// and the unspecified address aren't read as one
+func checkIPv6(text string, start, end int) (int, int, bool) {
+	ip := net.ParseIP(text[start:end])
+	if ip == nil || ip.To4() != nil || ip.IsUnspecified() {
+		return 0, 0, false
+	}
+	groups := 0
+	for _, group := range strings.Split(text[start:end], ":") {
+		if len(digitsOf(group)) > 0 {
+			groups++
+		}
+	}
+	return start, end, groups >= 2
+}
+
+// phone numbers have 9 to 15 digits, or 7 with a country code, and stand
+// apart from other digits and letters. Dates ("2024-01-15") and numbers
+// marked with '#', such as order numbers, are not phone numbers.
+func checkPhone(text string, start, end int) (int, int, bool) {
+	if start > 0 {
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		if unicode.IsLetter(before) || unicode.IsDigit(before) || before == '#' {
+			return 0, 0, false
+		}
+	}
+	if datePattern.MatchString(text[start:end]) {
+		return 0, 0, false
+	}
+	if end < len(text) {
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if unicode.IsLetter(after) || unicode.IsDigit(after) {
+			return 0, 0, false
+		}
+	}
+
+	digits := len(digitsOf(text[start:end]))
+	least := 9
+	if text[start] == '+' {
+		least = 7
+	}
+	return start, end, digits >= least && digits <= 15
+}
+
+func digitsOf(s string) []byte {
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if isDigit(s[i]) {
+			digits = append(digits, s[i])
+		}
+	}
+	return digits
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,207 @@
+package pii
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+func TestRedactFinds(t *testing.T) {
+	detector, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type found struct{ kind, value string }
+	tests := []struct {
+		name string
+		text string
+		want []found
+	}{
+		{"email", "mail john.doe+x@example.co.uk today", []found{{models.PIIEmail, "john.doe+x@example.co.uk"}}},
+		{"international phone", "call +44 20 7946 0958 now", []found{{models.PIIPhone, "+44 20 7946 0958"}}},
+		{"local phone", "my number is 555-123-4567", []found{{models.PIIPhone, "555-123-4567"}}},
+		{"card passing Luhn", "card 4111 1111 1111 1111 expired", []found{{models.PIICard, "4111 1111 1111 1111"}}},
+		{"card failing Luhn", "ref 4111 1111 1111 1112", nil},
+		{"IBAN before capitals", "send to DE89 3704 0044 0532 0130 00 PLEASE", []found{{models.PIIIBAN, "DE89 3704 0044 0532 0130 00"}}},
+		{"IPv4", "from 192.168.1.20 again", []found{{models.PIIIP, "192.168.1.20"}}},
+		{"IPv6", "host 2001:db8::8a2e:370:7334 down", []found{{models.PIIIP, "2001:db8::8a2e:370:7334"}}},
+		{"version string", "upgrade to v1.2.3.4.5", nil},
+		{"time of day", "meet at 10:30:00", nil},
+		{"date", "since 2024-01-15", nil},
+		{"dates", "ref 2024-01-15 2024-02-20", nil},
+		{"order number", "order #123456789", nil},
+		{"scoped name", "use std::vector", nil},
+		{"unspecified address", "listen on :: only", nil},
+		{"link-local IPv6", "via fe80::1 today", []found{{models.PIIIP, "fe80::1"}}},
+		{"short number", "order 12345", nil},
+		{"street address", "I live at 221B Baker Street, London", []found{{models.PIIAddress, "221B Baker Street"}}},
+		{"abbreviated street", "at 10 Downing St. today", []found{{models.PIIAddress, "10 Downing St."}}},
+		{"not an address", "I have 3 kids in the way", nil},
+		{"several kinds in order", "a@b.io or 555-123-4567, a@b.io", []found{
+			{models.PIIEmail, "a@b.io"},
+			{models.PIIPhone, "555-123-4567"},
+			{models.PIIEmail, "a@b.io"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redaction := detector.Redact(tt.text)
+			var got []found
+			runes := []rune(tt.text)
+			for _, f := range redaction.Findings {
+				got = append(got, found{f.Type, string(runes[f.Start:f.End])})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("found %v, want %v", got, tt.want)
+			}
+			for _, f := range tt.want {
+				if strings.Contains(redaction.Text, f.value) {
+					t.Errorf("%q still in %q", f.value, redaction.Text)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactPlaceholders(t *testing.T) {
+	detector, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redaction := detector.Redact("Écrivez à a@b.io ou c@d.io, pas a@b.io")
+	if want := "Écrivez à [EMAIL_1] ou [EMAIL_2], pas [EMAIL_1]"; redaction.Text != want {
+		t.Errorf("got %q, want %q", redaction.Text, want)
+	}
+	// Offsets are in characters, not bytes
+	if f := redaction.Findings[0]; f.Start != 10 || f.End != 16 {
+		t.Errorf("first finding at %d-%d, want 10-16", f.Start, f.End)
+	}
+
+	// Other texts of the conversation share placeholders
+	if got := redaction.Also("earlier: c@d.io and e@f.io"); got != "earlier: [EMAIL_2] and [EMAIL_3]" {
+		t.Errorf("Also: got %q", got)
+	}
+	if len(redaction.Findings) != 3 {
+		t.Errorf("Also reported findings: %d, want 3", len(redaction.Findings))
+	}
+}
+
+func TestNewLimitsKinds(t *testing.T) {
+	detector, err := New([]string{models.PIIEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	redaction := detector.Redact("a@b.io or 555-123-4567")
+	if redaction.Text != "[EMAIL_1] or 555-123-4567" {
+		t.Errorf("got %q", redaction.Text)
+	}
+
+	if _, err := New([]string{"passport"}); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+
+	var none *Detector
+	if got := none.Redact("a@b.io").Text; got != "a@b.io" {
+		t.Errorf("nil detector redacted %q", got)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	detector, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redaction := detector.Redact("Email a@b.io or call 555-123-4567")
+	reply := "We will email [EMAIL_1] and call [PHONE_1], not [PHONE_9]."
+
+	tests := []struct {
+		name    string
+		restore func(kind string) bool
+		want    string
+	}{
+		{"restore all", func(string) bool { return true }, "We will email a@b.io and call 555-123-4567, not [PHONE_9]."},
+		{"redact all", func(string) bool { return false }, "We will email [EMAIL] and call [PHONE], not [PHONE_9]."},
+		{"by kind", func(kind string) bool { return kind == models.PIIEmail }, "We will email a@b.io and call [PHONE], not [PHONE_9]."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redaction.Restore(reply, tt.restore); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The round trip gives back the original text
+	if got := redaction.Restore(redaction.Text, func(string) bool { return true }); got != redaction.Original {
+		t.Errorf("round trip: got %q, want %q", got, redaction.Original)
+	}
+}
+
+func TestRestorerChunks(t *testing.T) {
+	detector, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redaction := detector.Redact("Email a@b.io please")
+	restoreAll := func(string) bool { return true }
+
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"whole placeholder", []string{"Hi [EMAIL_1]!"}, "Hi a@b.io!"},
+		{"split placeholder", []string{"Hi [EM", "AIL", "_1", "] bye"}, "Hi a@b.io bye"},
+		{"bracket that isn't a placeholder", []string{"see [note", "] here"}, "see [note] here"},
+		{"unterminated at the end", []string{"trailing [EMAIL_"}, "trailing [EMAIL_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := redaction.Restorer(restoreAll)
+			var out strings.Builder
+			for _, chunk := range tt.chunks {
+				written := w.Write(chunk)
+				if strings.Contains(written, "[EMAIL_1") {
+					t.Errorf("a placeholder leaked out unrestored: %q", written)
+				}
+				out.WriteString(written)
+			}
+			out.WriteString(w.Flush())
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+
+	// Reset drops what is held back
+	w := redaction.Restorer(restoreAll)
+	w.Write("start [EMA")
+	w.Reset()
+	if got := w.Write("over") + w.Flush(); got != "over" {
+		t.Errorf("after Reset: got %q", got)
+	}
+}
+
+func TestTrimPartial(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"write to [EMAIL", "write to "},
+		{"write to [EMAIL_1", "write to "},
+		{"write to [", "write to "},
+		{"write to [EMAIL_1]", "write to [EMAIL_1]"},
+		{"see [note] here", "see [note] here"},
+		{"see [note", "see [note"},
+	}
+	for _, tt := range tests {
+		if got := TrimPartial(tt.in); got != tt.want {
+			t.Errorf("TrimPartial(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
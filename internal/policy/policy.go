@@ -0,0 +1,192 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+// Policy maps toxicity scores to a moderation action. Rules are evaluated top
+// to bottom and the first match wins.
+type Policy struct {
+	Name string `yaml:"name"`
+	// Action when no rule matches a toxic verdict
+	ToxicDefault string `yaml:"toxic_default"`
+	// Action when no rule matches a clean verdict
+	CleanDefault string `yaml:"clean_default"`
+	// Action when the toxicity check itself failed
+	OnCheckFailure string `yaml:"on_check_failure"`
+	Rules          []Rule `yaml:"rules"`
+	// What becomes of personal data redacted before prompting
+	PII PIIHandling `yaml:"pii"`
+}
+
+// PIIHandling decides, per kind of personal data, whether values redacted
+// before prompting are put back into rewrites and replies or left redacted
+type PIIHandling struct {
+	// "restore" or "redact", for kinds not listed in Types
+	Default string `yaml:"default"`
+	// Per-kind overrides, e.g. {card: redact}
+	Types map[string]string `yaml:"types"`
+}
+
+// Rule fires when category scores reach their thresholds
+type Rule struct {
+	Name string `yaml:"name"`
+	// Minimum score per category, e.g. {threat: 0.7}
+	When map[string]float64 `yaml:"when"`
+	// "any" (default) or "all" of the When thresholds must be met
+	Match string `yaml:"match"`
+	// Optional minimum verdict confidence
+	MinConfidence float64 `yaml:"min_confidence"`
+	Action        string  `yaml:"action"`
+}
+
+// Decision is the outcome of evaluating a policy
+type Decision struct {
+	Action string
+	Rule   string
+}
+
+// Default reproduces the original behaviour: rewrite toxic comments, allow the rest
+func Default() *Policy {
+	return &Policy{
+		Name:           "default",
+		ToxicDefault:   models.ActionRewrite,
+		CleanDefault:   models.ActionAllow,
+		OnCheckFailure: models.ActionAllow,
+		PII:            PIIHandling{Default: models.PIIRestore},
+	}
+}
+
+// Load reads a YAML policy file, falling back to Default when path is empty
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	p := Default()
+	p.Name = path
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	for _, action := range []string{p.ToxicDefault, p.CleanDefault, p.OnCheckFailure} {
+		if !isAction(action) {
+			return fmt.Errorf("unknown action %q", action)
+		}
+	}
+
+	if !isPIIHandling(p.PII.Default) {
+		return fmt.Errorf("pii: default must be %s or %s", models.PIIRestore, models.PIIRedact)
+	}
+	for kind, handling := range p.PII.Types {
+		if !models.IsPIIType(kind) {
+			return fmt.Errorf("pii: unknown type %q", kind)
+		}
+		if !isPIIHandling(handling) {
+			return fmt.Errorf("pii: %s must be %s or %s", kind, models.PIIRestore, models.PIIRedact)
+		}
+	}
+
+	for i, rule := range p.Rules {
+		if rule.Name == "" {
+			p.Rules[i].Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if !isAction(rule.Action) {
+			return fmt.Errorf("rule %s: unknown action %q", p.Rules[i].Name, rule.Action)
+		}
+		if rule.Match != "" && rule.Match != "any" && rule.Match != "all" {
+			return fmt.Errorf("rule %s: match must be any or all", p.Rules[i].Name)
+		}
+		if len(rule.When) == 0 {
+			return fmt.Errorf("rule %s: when is required", p.Rules[i].Name)
+		}
+		for category, threshold := range rule.When {
+			if !models.IsToxicityCategory(category) {
+				return fmt.Errorf("rule %s: unknown category %q", p.Rules[i].Name, category)
+			}
+			if threshold < 0 || threshold > 1 {
+				return fmt.Errorf("rule %s: %s threshold %v outside [0, 1]", p.Rules[i].Name, category, threshold)
+			}
+		}
+	}
+	return nil
+}
+
+// Evaluate picks the action for a verdict; a nil verdict means the check failed
+func (p *Policy) Evaluate(verdict *models.ToxicityVerdict) Decision {
+	if verdict == nil {
+		return Decision{Action: p.OnCheckFailure, Rule: "on_check_failure"}
+	}
+
+	for _, rule := range p.Rules {
+		if rule.matches(verdict) {
+			return Decision{Action: rule.Action, Rule: rule.Name}
+		}
+	}
+
+	if verdict.IsToxic() {
+		return Decision{Action: p.ToxicDefault, Rule: "toxic_default"}
+	}
+	return Decision{Action: p.CleanDefault, Rule: "clean_default"}
+}
+
+// PIIHandling returns restore or redact for a kind of personal data
+func (p *Policy) PIIHandling(kind string) string {
+	if handling, ok := p.PII.Types[kind]; ok {
+		return handling
+	}
+	return p.PII.Default
+}
+
+// RestorePII reports whether values of a kind go back into rewrites and replies
+func (p *Policy) RestorePII(kind string) bool {
+	return p.PIIHandling(kind) == models.PIIRestore
+}
+
+func (r Rule) matches(verdict *models.ToxicityVerdict) bool {
+	if verdict.Confidence < r.MinConfidence {
+		return false
+	}
+
+	all := r.Match == "all"
+	for category, threshold := range r.When {
+		hit := verdict.Score(category) >= threshold
+		if hit && !all {
+			return true
+		}
+		if !hit && all {
+			return false
+		}
+	}
+	return all
+}
+
+func isAction(action string) bool {
+	switch action {
+	case models.ActionAllow, models.ActionRewrite, models.ActionMask,
+		models.ActionBlock, models.ActionHold, models.ActionEscalate:
+		return true
+	}
+	return false
+}
+
+func isPIIHandling(handling string) bool {
+	return handling == models.PIIRestore || handling == models.PIIRedact
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+func toxic(confidence float64, scores map[string]float64) *models.ToxicityVerdict {
+	return &models.ToxicityVerdict{Verdict: models.VerdictToxic, Scores: scores, Confidence: confidence}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := Load("../../configs/policy.yaml")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		verdict *models.ToxicityVerdict
+		action  string
+		rule    string
+	}{
+		{"check failed", nil, models.ActionAllow, "on_check_failure"},
+		{"clean, no rule matches", &models.ToxicityVerdict{Verdict: models.VerdictClean, Confidence: 0.9}, models.ActionAllow, "clean_default"},
+		{"toxic, no rule matches", toxic(0.9, map[string]float64{"harassment": 0.9}), models.ActionRewrite, "toxic_default"},
+		{"at the threshold", toxic(0.9, map[string]float64{"threat": 0.7}), models.ActionEscalate, "threats"},
+		{"just under the threshold", toxic(0.9, map[string]float64{"threat": 0.69}), models.ActionRewrite, "toxic_default"},
+		{"first match wins", toxic(0.9, map[string]float64{"threat": 0.9, "hate": 0.9}), models.ActionEscalate, "threats"},
+		{"per-category thresholds", toxic(0.9, map[string]float64{"hate": 0.75, "sexual": 0.75}), models.ActionBlock, "hate-speech"},
+		{"a lower threshold further down", toxic(0.9, map[string]float64{"sexual": 0.75, "self_harm": 0.5}), models.ActionEscalate, "self-harm"},
+		{"min confidence met", toxic(0.7, map[string]float64{"spam": 0.9}), models.ActionBlock, "spam"},
+		{"min confidence missed", toxic(0.6, map[string]float64{"spam": 0.9}), models.ActionRewrite, "toxic_default"},
+		{"all thresholds met", toxic(0.9, map[string]float64{"profanity": 0.5, "harassment": 0.5}), models.ActionRewrite, "mild-profanity"},
+		{"only some of all met", toxic(0.9, map[string]float64{"profanity": 0.5, "harassment": 0.4}), models.ActionMask, "profanity-only"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := p.Evaluate(tt.verdict)
+			if decision.Action != tt.action || decision.Rule != tt.rule {
+				t.Errorf("got %s by %s, want %s by %s", decision.Action, decision.Rule, tt.action, tt.rule)
+			}
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	p, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := p.Evaluate(toxic(0.9, map[string]float64{"threat": 1})).Action; got != models.ActionRewrite {
+		t.Errorf("toxic: %s, want rewrite", got)
+	}
+	if got := p.Evaluate(&models.ToxicityVerdict{Verdict: models.VerdictClean}).Action; got != models.ActionAllow {
+		t.Errorf("clean: %s, want allow", got)
+	}
+	if !p.RestorePII(models.PIICard) {
+		t.Error("the default policy redacts cards")
+	}
+}
+
+func TestPIIHandling(t *testing.T) {
+	p, err := Load("../../configs/policy.yaml")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for kind, restore := range map[string]bool{models.PIIEmail: true, models.PIICard: false, models.PIIIBAN: false} {
+		if got := p.RestorePII(kind); got != restore {
+			t.Errorf("RestorePII(%s) = %v, want %v", kind, got, restore)
+		}
+	}
+}
+
+func TestLoadRejectsInvalidPolicies(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"unknown rule action", "rules:\n  - when: {threat: 0.5}\n    action: ban", `rule rule-1: unknown action "ban"`},
+		{"unknown default action", "toxic_default: delete", `unknown action "delete"`},
+		{"unknown category", "rules:\n  - name: rude\n    when: {rudeness: 0.5}\n    action: block", `unknown category "rudeness"`},
+		{"threshold out of range", "rules:\n  - when: {threat: 70}\n    action: block", "outside [0, 1]"},
+		{"no thresholds", "rules:\n  - name: empty\n    action: block", "when is required"},
+		{"bad match", "rules:\n  - when: {threat: 0.5}\n    match: most\n    action: block", "match must be any or all"},
+		{"unknown pii type", "pii:\n  types: {passport: redact}", `unknown type "passport"`},
+		{"bad pii handling", "pii:\n  default: hide", "default must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package prefilter
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/harshaSenaratne/reword/internal/normalize"
+)
+
+// Filter settles obviously abusive or obviously clean comments locally, before
+// any model is asked. Blocklist terms and toxic rules are tried first, so a
+// comment that trips one is never let through by an allowlist entry; comments
+// nothing settles go on to the toxicity check. Comments, blocklist terms and
+// allowlist entries are all normalized the same way before they are compared.
+type Filter struct {
+	Name      string            `yaml:"name"`
+	Normalize normalize.Options `yaml:"normalize"`
+	Blocklist []BlockRule       `yaml:"blocklist"`
+	// Allowlist holds comments that are clean as a whole, compared after normalization
+	Allowlist []string `yaml:"allowlist"`
+	Rules     []Rule   `yaml:"rules"`
+
+	allow map[string]bool
+}
+
+// BlockRule flags a comment containing any of its terms as whole words.
+// Letters of a term may be stretched up to the normalizer's MaxRepeat, so
+// "stupid" also matches "stuupid", which is what "stuuupid" normalizes to.
+type BlockRule struct {
+	Name     string   `yaml:"name"`
+	Terms    []string `yaml:"terms"`
+	Category string   `yaml:"category"`
+	// Score given to Category, 1 when unset
+	Score  float64 `yaml:"score"`
+	Reason string  `yaml:"reason"`
+
+	terms []*regexp.Regexp
+}
+
+// Rule matches a regular expression against the normalized comment, or the
+// comment as written when Raw is set
+type Rule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+	// "toxic" or "clean"
+	Verdict string `yaml:"verdict"`
+	// Category and Score apply to toxic rules; Score is 1 when unset
+	Category string  `yaml:"category"`
+	Score    float64 `yaml:"score"`
+	Reason   string  `yaml:"reason"`
+	Raw      bool    `yaml:"raw"`
+
+	pattern *regexp.Regexp
+}
+
+// Match is a comment settled by the filter and the rule that settled it. Toxic
+// verdicts carry the span of the original comment that matched.
+type Match struct {
+	Rule    string
+	Verdict *models.ToxicityVerdict
+}
+
+// Default has no rules, so every comment goes to the toxicity check. Its
+// normalization also reads leetspeak, which only ever decides matches here and
+// never reaches a model.
+func Default() *Filter {
+	opts := normalize.Default()
+	opts.Lowercase = true
+	opts.Leetspeak = true
+	opts.StripPunctuation = true
+	return &Filter{Name: "none", Normalize: opts}
+}
+
+// Load reads a YAML filter file, falling back to Default when path is empty
+func Load(path string) (*Filter, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prefilter file: %w", err)
+	}
+
+	f := Default()
+	f.Name = path
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse prefilter file: %w", err)
+	}
+	if err := f.compile(); err != nil {
+		return nil, fmt.Errorf("invalid prefilter %s: %w", path, err)
+	}
+
+	return f, nil
+}
+
+func (f *Filter) compile() error {
+	for i := range f.Blocklist {
+		rule := &f.Blocklist[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("blocklist-%d", i+1)
+		}
+		if !models.IsToxicityCategory(rule.Category) {
+			return fmt.Errorf("blocklist %s: unknown category %q", rule.Name, rule.Category)
+		}
+		if err := checkScore(&rule.Score); err != nil {
+			return fmt.Errorf("blocklist %s: %w", rule.Name, err)
+		}
+		for _, term := range rule.Terms {
+			if normalized := f.normalize(term); normalized != "" {
+				rule.terms = append(rule.terms, termPattern(normalized, f.Normalize.MaxRepeat))
+			}
+		}
+		if len(rule.terms) == 0 {
+			return fmt.Errorf("blocklist %s: terms are required", rule.Name)
+		}
+	}
+
+	f.allow = make(map[string]bool, len(f.Allowlist))
+	for _, entry := range f.Allowlist {
+		if normalized := f.normalize(entry); normalized != "" {
+			f.allow[normalized] = true
+		}
+	}
+
+	for i := range f.Rules {
+		rule := &f.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		rule.pattern = pattern
+
+		switch rule.Verdict {
+		case models.VerdictToxic:
+			if !models.IsToxicityCategory(rule.Category) {
+				return fmt.Errorf("rule %s: unknown category %q", rule.Name, rule.Category)
+			}
+			if err := checkScore(&rule.Score); err != nil {
+				return fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		case models.VerdictClean:
+		default:
+			return fmt.Errorf("rule %s: verdict must be %s or %s", rule.Name, models.VerdictToxic, models.VerdictClean)
+		}
+	}
+	return nil
+}
+
+func checkScore(score *float64) error {
+	if *score == 0 {
+		*score = 1
+	}
+	if *score < 0 || *score > 1 {
+		return fmt.Errorf("score %v outside [0, 1]", *score)
+	}
+	return nil
+}
+
+// Enabled reports whether the filter has any rules at all
+func (f *Filter) Enabled() bool {
+	return len(f.Blocklist) > 0 || len(f.allow) > 0 || len(f.Rules) > 0
+}
+
+// Check returns the verdict for a comment the filter can settle, or nil
+func (f *Filter) Check(comment string) *Match {
+	if !f.Enabled() {
+		return nil
+	}
+	text := normalize.Apply(comment, f.Normalize)
+
+	for _, rule := range f.Blocklist {
+		for _, term := range rule.terms {
+			if loc := term.FindStringSubmatchIndex(text.Normalized); loc != nil {
+				start, end := text.Span(loc[2], loc[3])
+				reason := rule.Reason
+				if reason == "" {
+					reason = fmt.Sprintf("The comment contains a blocked term (%s)", rule.Name)
+				}
+				return toxic(rule.Name, rule.Category, rule.Score, reason, span(comment, start, end, rule.Name))
+			}
+		}
+	}
+	for _, rule := range f.Rules {
+		if rule.Verdict != models.VerdictToxic {
+			continue
+		}
+		if start, end, ok := rule.find(text); ok {
+			reason := rule.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("The comment matches a blocked pattern (%s)", rule.Name)
+			}
+			return toxic(rule.Name, rule.Category, rule.Score, reason, span(comment, start, end, rule.Name))
+		}
+	}
+
+	if f.allow[text.Normalized] {
+		return clean("allowlist", "The comment is on the allowlist")
+	}
+	for _, rule := range f.Rules {
+		if rule.Verdict != models.VerdictClean {
+			continue
+		}
+		if _, _, ok := rule.find(text); ok {
+			reason := rule.Reason
+			if reason == "" {
+				reason = fmt.Sprintf("The comment matches an allowed pattern (%s)", rule.Name)
+			}
+			return clean(rule.Name, reason)
+		}
+	}
+	return nil
+}
+
+// finds the rule's pattern, returning the byte span of the original comment it matched
+func (r Rule) find(text *normalize.Text) (int, int, bool) {
+	if r.Raw {
+		loc := r.pattern.FindStringIndex(text.Original)
+		if loc == nil {
+			return 0, 0, false
+		}
+		return loc[0], loc[1], true
+	}
+
+	loc := r.pattern.FindStringIndex(text.Normalized)
+	if loc == nil {
+		return 0, 0, false
+	}
+	start, end := text.Span(loc[0], loc[1])
+	return start, end, true
+}
+
+// compiles a normalized term into a whole-word pattern. A run of a letter
+// shorter than max may be stretched up to max, the most normalization leaves.
+func termPattern(term string, max int) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?:^| )(")
+	runes := []rune(term)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && runes[j] == runes[i] {
+			j++
+		}
+		letter := regexp.QuoteMeta(string(runes[i]))
+		if n := j - i; n < max && unicode.IsLetter(runes[i]) {
+			fmt.Fprintf(&b, "(?:%s){%d,%d}", letter, n, max)
+		} else {
+			b.WriteString(strings.Repeat(letter, n))
+		}
+		i = j
+	}
+	b.WriteString(")(?: |$)")
+	return regexp.MustCompile(b.String())
+}
+
+func (f *Filter) normalize(text string) string {
+	return normalize.Apply(text, f.Normalize).Normalized
+}
+
+// reports a byte span of the comment in characters
+func span(comment string, start, end int, rule string) models.FlaggedSpan {
+	return models.FlaggedSpan{
+		Start: utf8.RuneCountInString(comment[:start]),
+		End:   utf8.RuneCountInString(comment[:end]),
+		Text:  comment[start:end],
+		Rule:  rule,
+	}
+}
+
+func toxic(rule, category string, score float64, reason string, flagged models.FlaggedSpan) *Match {
+	verdict := emptyVerdict(models.VerdictToxic, reason)
+	verdict.Spans = []models.FlaggedSpan{flagged}
+	verdict.Scores[category] = score
+	if score >= 0.5 {
+		verdict.Categories = []string{category}
+	}
+	return &Match{Rule: rule, Verdict: verdict}
+}
+
+func clean(rule, reason string) *Match {
+	return &Match{Rule: rule, Verdict: emptyVerdict(models.VerdictClean, reason)}
+}
+
+// a verdict shaped like a validated model verdict, every category scored
+func emptyVerdict(verdict, reason string) *models.ToxicityVerdict {
+	scores := make(map[string]float64, len(models.ToxicityCategories))
+	for _, category := range models.ToxicityCategories {
+		scores[category] = 0
+	}
+	return &models.ToxicityVerdict{
+		Verdict:    verdict,
+		Scores:     scores,
+		Categories: []string{},
+		Confidence: 1,
+		Reason:     reason,
+	}
+}
@@ -0,0 +1,114 @@
+package prefilter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+func TestCheck(t *testing.T) {
+	filter, err := Load("../../configs/prefilter.yaml")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		comment  string
+		rule     string
+		verdict  string
+		category string
+		span     [2]int
+	}{
+		{"blocklist term", "You are an idiot", "insults", models.VerdictToxic, "harassment", [2]int{11, 16}},
+		{"leetspeak", "You are such an 1d10t!", "insults", models.VerdictToxic, "harassment", [2]int{16, 21}},
+		{"homoglyphs", "Wow, ѕtupіd idea", "insults", models.VerdictToxic, "harassment", [2]int{5, 11}},
+		{"spaced out", "you are s t u p i d", "insults", models.VerdictToxic, "harassment", [2]int{8, 19}},
+		{"stretched letters", "so stuuuuupid", "insults", models.VerdictToxic, "harassment", [2]int{3, 13}},
+		{"stretched letters of a doubled term", "shut uuuup", "insults", models.VerdictToxic, "harassment", [2]int{0, 10}},
+		{"multi-word term", "just shut up already", "insults", models.VerdictToxic, "harassment", [2]int{5, 12}},
+		{"regex on normalized text", "I'm going to hurt you", "threats", models.VerdictToxic, "threat", [2]int{0, 21}},
+		{"raw regex", "see http://a.example http://b.example http://c.example", "link-spam", models.VerdictToxic, "spam", [2]int{4, 54}},
+		{"blocklist beats allowlist", "thanks idiot", "insults", models.VerdictToxic, "harassment", [2]int{7, 12}},
+		{"allowlist", "Thank you!!", "allowlist", models.VerdictClean, "", [2]int{}},
+		{"clean rule", "Thanks so much for sharing", "short-praise", models.VerdictClean, "", [2]int{}},
+		{"terms match whole words", "The stupidity of this bug", "", "", "", [2]int{}},
+		{"single letters may be doubled", "moroon is not a word", "insults", models.VerdictToxic, "harassment", [2]int{0, 6}},
+		{"digits inside words", "ripped some mp3s for i18n testing", "", "", "", [2]int{}},
+		{"unsettled", "The delivery was late", "", "", "", [2]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match := filter.Check(tt.comment)
+			if tt.rule == "" {
+				if match != nil {
+					t.Fatalf("settled by %s, want it left to the model", match.Rule)
+				}
+				return
+			}
+			if match == nil {
+				t.Fatalf("not settled, want %s", tt.rule)
+			}
+			if match.Rule != tt.rule || match.Verdict.Verdict != tt.verdict {
+				t.Fatalf("got %s %s, want %s %s", match.Rule, match.Verdict.Verdict, tt.rule, tt.verdict)
+			}
+			if tt.verdict != models.VerdictToxic {
+				return
+			}
+
+			if !reflect.DeepEqual(match.Verdict.Categories, []string{tt.category}) {
+				t.Errorf("categories %v, want [%s]", match.Verdict.Categories, tt.category)
+			}
+			if len(match.Verdict.Spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(match.Verdict.Spans))
+			}
+			span := match.Verdict.Spans[0]
+			want := string([]rune(tt.comment)[tt.span[0]:tt.span[1]])
+			if span.Start != tt.span[0] || span.End != tt.span[1] || span.Text != want {
+				t.Errorf("span %d-%d %q, want %d-%d %q", span.Start, span.End, span.Text, tt.span[0], tt.span[1], want)
+			}
+		})
+	}
+}
+
+func TestDefaultSettlesNothing(t *testing.T) {
+	filter := Default()
+	if filter.Enabled() {
+		t.Error("the default filter has rules")
+	}
+	if match := filter.Check("you idiot"); match != nil {
+		t.Errorf("settled by %s", match.Rule)
+	}
+}
+
+func TestLoadRejectsInvalidFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"unknown category", "blocklist:\n  - terms: [idiot]\n    category: rudeness", "unknown category"},
+		{"no terms", "blocklist:\n  - name: empty\n    category: harassment\n    terms: ['!!']", "terms are required"},
+		{"score out of range", "blocklist:\n  - terms: [idiot]\n    category: harassment\n    score: 2", "outside [0, 1]"},
+		{"bad pattern", "rules:\n  - pattern: '(unclosed'\n    verdict: clean", "missing closing"},
+		{"bad verdict", "rules:\n  - pattern: 'x'\n    verdict: maybe", "verdict must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "prefilter.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Load(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -6,56 +6,105 @@ import (
     "strings"
     
     "github.com/sirupsen/logrus"
+    "github.com/harshaSenaratne/reword/internal/cache"
+    "github.com/harshaSenaratne/reword/internal/models"
     "github.com/harshaSenaratne/reword/pkg/llm"
 )
 
 type AssistantService struct {
     llmClient *llm.Client
+    results   *cache.Results
     logger    *logrus.Logger
 }
 
-func NewAssistantService(llmClient *llm.Client, logger *logrus.Logger) *AssistantService {
+func NewAssistantService(llmClient *llm.Client, results *cache.Results, logger *logrus.Logger) *AssistantService {
     return &AssistantService{
         llmClient: llmClient,
+        results:   results,
         logger:    logger,
     }
 }
 
 //  generates a response based on sentiment and customer request
-func (s *AssistantService) GenerateResponse(ctx context.Context, sentiment, customerRequest string) (string, error) {
+func (s *AssistantService) GenerateResponse(ctx context.Context, sentiment, customerRequest string, history []models.Message) (string, models.StepInfo, error) {
+    return s.generateResponse(ctx, sentiment, customerRequest, history, nil)
+}
+
+//  generates a response, streaming it to handler as the model writes it.
+//  Cached replies are not streamed.
+func (s *AssistantService) StreamResponse(ctx context.Context, sentiment, customerRequest string, history []models.Message, handler llm.StreamHandler) (string, models.StepInfo, error) {
+    return s.generateResponse(ctx, sentiment, customerRequest, history, handler)
+}
+
+func (s *AssistantService) generateResponse(ctx context.Context, sentiment, customerRequest string, history []models.Message, handler llm.StreamHandler) (string, models.StepInfo, error) {
     // Default sentiment if not provided
     if sentiment == "" {
         sentiment = "helpful and professional"
     }
 
-    prompt := s.buildPrompt(sentiment, customerRequest)
-    
-    s.logger.WithFields(logrus.Fields{
-        "sentiment": sentiment,
-        "request":   customerRequest,
-    }).Debug("Generating assistant response")
-
-    response, err := s.llmClient.GenerateResponse(ctx, s.llmClient.GetAssistantLLM(), prompt)
-    if err != nil {
-        s.logger.WithError(err).Error("Failed to generate assistant response")
-        return "", fmt.Errorf("assistant response generation failed: %w", err)
+    inputs := []string{sentiment, cache.Normalize(customerRequest)}
+    for _, message := range history {
+        inputs = append(inputs, message.Role, cache.Normalize(message.Content))
     }
+    return fetchStep(ctx, s.results, s.llmClient, llm.RoleAssistant, models.StepReply, replyPromptVersion, inputs, func() (string, models.StepInfo, error) {
+        prompt := s.buildPrompt(sentiment, customerRequest, history)
 
-    s.logger.WithField("response", response).Debug("Assistant response generated")
-    
-    return strings.TrimSpace(response), nil
+        s.logger.WithFields(logrus.Fields{
+            "sentiment": sentiment,
+            "request":   customerRequest,
+        }).Debug("Generating assistant response")
+
+        var generation *llm.Generation
+        var err error
+        if handler != nil {
+            generation, err = s.llmClient.Stream(ctx, llm.RoleAssistant, prompt, handler)
+        } else {
+            generation, err = s.llmClient.Generate(ctx, llm.RoleAssistant, prompt)
+        }
+        if err != nil {
+            s.logger.WithError(err).Error("Failed to generate assistant response")
+            return "", models.StepInfo{}, fmt.Errorf("assistant response generation failed: %w", err)
+        }
+
+        s.logger.WithFields(logrus.Fields{
+            "response": generation.Text,
+            "model":    generation.Model,
+        }).Debug("Assistant response generated")
+
+        return strings.TrimSpace(generation.Text), stepInfo(generation), nil
+    })
 }
 
-func (s *AssistantService) buildPrompt(sentiment, customerRequest string) string {
+func (s *AssistantService) buildPrompt(sentiment, customerRequest string, history []models.Message) string {
     template := `You are a %s assistant that responds to user comments, using similar vocabulary as the user.
-User: "%s"
+%sUser: "%s"
 Comment:`
 
-    return fmt.Sprintf(template, sentiment, customerRequest)
+    // Earlier turns of a live conversation, oldest first
+    var conversation strings.Builder
+    if len(history) > 0 {
+        conversation.WriteString("Conversation so far:\n")
+        for _, message := range history {
+            speaker := "User"
+            if message.Role == models.RoleAssistant {
+                speaker = "Assistant"
+            }
+            fmt.Fprintf(&conversation, "%s: %q\n", speaker, message.Content)
+        }
+    }
+
+    return fmt.Sprintf(template, sentiment, conversation.String(), customerRequest)
 }
 
 //  analyzes the sentiment of the customer request
-func (s *AssistantService) AnalyzeSentiment(ctx context.Context, customerRequest string) (string, error) {
+func (s *AssistantService) AnalyzeSentiment(ctx context.Context, customerRequest string) (string, models.StepInfo, error) {
+    inputs := []string{cache.Normalize(customerRequest)}
+    return fetchStep(ctx, s.results, s.llmClient, llm.RoleAssistant, models.StepSentiment, sentimentPromptVersion, inputs, func() (string, models.StepInfo, error) {
+        return s.analyzeSentiment(ctx, customerRequest)
+    })
+}
+
+func (s *AssistantService) analyzeSentiment(ctx context.Context, customerRequest string) (string, models.StepInfo, error) {
     prompt := fmt.Sprintf(`Analyze the sentiment of the following comment and respond with only one word: 
     positive, negative, or neutral.
     
@@ -63,15 +112,32 @@ func (s *AssistantService) AnalyzeSentiment(ctx context.Context, customerRequest
     
     Sentiment:`, customerRequest)
 
-    response, err := s.llmClient.GenerateResponse(ctx, s.llmClient.GetAssistantLLM(), prompt)
+    generation, err := s.llmClient.Generate(ctx, llm.RoleAssistant, prompt)
     if err != nil {
-        return "neutral", err
+        return "neutral", models.StepInfo{}, err
     }
 
-    sentiment := strings.ToLower(strings.TrimSpace(response))
+    sentiment := strings.ToLower(strings.TrimSpace(generation.Text))
     if sentiment != "positive" && sentiment != "negative" && sentiment != "neutral" {
         sentiment = "neutral"
     }
 
-    return sentiment, nil
+    return sentiment, stepInfo(generation), nil
+}
+
+// records which model served a step and the tokens it spent
+func stepInfo(generation *llm.Generation) models.StepInfo {
+    return models.StepInfo{
+        Model:    generation.Model,
+        Fallback: generation.Fallback,
+        Tokens:   tokenUsage(generation.Usage),
+    }
+}
+
+func tokenUsage(usage llm.TokenUsage) *models.TokenUsage {
+    return &models.TokenUsage{
+        Prompt:     usage.PromptTokens,
+        Completion: usage.CompletionTokens,
+        Total:      usage.Total(),
+    }
 }
\ No newline at end of file
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+// ItemOutcome is how one comment of a batch or stream went. Err is set when
+// it failed, and Cancelled when it failed because ctx was cancelled.
+type ItemOutcome struct {
+	Index     int
+	Response  *models.ModeratedResponse
+	Err       error
+	Cancelled bool
+}
+
+// ProcessBatch moderates several comments concurrently, at most limit at a time
+// (0 means unbounded), and reports on each in input order. One failure doesn't
+// sink the batch; once ctx is cancelled the items not yet started are skipped.
+func (s *ChainService) ProcessBatch(ctx context.Context, limit int, requests []*models.CommentRequest) []ItemOutcome {
+	outcomes := make([]ItemOutcome, len(requests))
+
+	if limit <= 0 || limit > len(requests) {
+		limit = len(requests)
+	}
+	slots := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	for i, req := range requests {
+		wg.Add(1)
+		go func(index int, request *models.CommentRequest) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+			}
+			outcomes[index] = s.ProcessItem(ctx, index, request)
+		}(i, req)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// ProcessItem moderates one comment of a batch or stream. A nil request fails
+// with ErrInvalidItem, and one reached after ctx is cancelled is marked
+// cancelled without running.
+func (s *ChainService) ProcessItem(ctx context.Context, index int, request *models.CommentRequest) ItemOutcome {
+	if request == nil {
+		return ItemOutcome{Index: index, Err: ErrInvalidItem}
+	}
+	if err := ctx.Err(); err != nil {
+		return ItemOutcome{Index: index, Err: err, Cancelled: true}
+	}
+
+	response, err := s.ProcessComment(ctx, request)
+	if err != nil {
+		cancelled := ctx.Err() != nil
+		if !cancelled {
+			s.logger.WithError(err).WithField("index", index).Warn("Item failed")
+		}
+		return ItemOutcome{Index: index, Err: err, Cancelled: cancelled}
+	}
+	return ItemOutcome{Index: index, Response: response}
+}
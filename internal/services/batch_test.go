@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+func TestProcessBatchReportsEachItem(t *testing.T) {
+	chain, _ := newTestChain(t, nil)
+
+	requests := []*models.CommentRequest{
+		{Comment: "the parcel arrived"},
+		nil,
+		{Comment: "you idiot"},
+	}
+	outcomes := chain.ProcessBatch(context.Background(), 1, requests)
+	if len(outcomes) != len(requests) {
+		t.Fatalf("%d outcomes, want %d", len(outcomes), len(requests))
+	}
+	for i, outcome := range outcomes {
+		if outcome.Index != i {
+			t.Errorf("outcome %d has index %d", i, outcome.Index)
+		}
+	}
+	if outcome := outcomes[1]; !errors.Is(outcome.Err, ErrInvalidItem) || outcome.Cancelled {
+		t.Errorf("nil item: %+v, want ErrInvalidItem", outcome)
+	}
+	if outcome := outcomes[2]; outcome.Err != nil || outcome.Response == nil || !outcome.Response.WasModified {
+		t.Errorf("toxic item: %+v, want a rewrite", outcome)
+	}
+}
+
+func TestProcessBatchSkipsItemsOnceCancelled(t *testing.T) {
+	chain, ledger := newTestChain(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	outcomes := chain.ProcessBatch(ctx, 0, []*models.CommentRequest{{Comment: "hello", Tenant: "acme"}, {Comment: "thanks", Tenant: "acme"}})
+	for _, outcome := range outcomes {
+		if !outcome.Cancelled || !errors.Is(outcome.Err, context.Canceled) {
+			t.Errorf("item %d: %+v, want cancelled", outcome.Index, outcome)
+		}
+	}
+	if report := ledger.Report("acme"); report.Total.Requests != 0 {
+		t.Errorf("%d cancelled items were run", report.Total.Requests)
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"context"
+
+	"github.com/harshaSenaratne/reword/internal/cache"
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/harshaSenaratne/reword/pkg/llm"
+)
+
+// Prompt versions are part of every cache key; bump one whenever its prompt changes
+const (
+	toxicityPromptVersion   = "v3"
+	moderationPromptVersion = "v1"
+	maskPromptVersion       = "v1"
+	sentimentPromptVersion  = "v1"
+	replyPromptVersion      = "v1"
+)
+
+// fetchStep serves a step from the result cache, keyed by the role's primary model.
+// Results produced by a fallback model are not cached so the primary gets retried.
+func fetchStep[T any](ctx context.Context, results *cache.Results, llmClient *llm.Client, role llm.Role, step, version string, inputs []string, compute func() (T, models.StepInfo, error)) (T, models.StepInfo, error) {
+	var model string
+	if chain := llmClient.Models(role); len(chain) > 0 {
+		model = chain[0]
+	}
+	key := cache.Key(step, model, version, inputs...)
+
+	type entry struct {
+		Value T               `json:"value"`
+		Step  models.StepInfo `json:"step"`
+	}
+	cached, hit, err := cache.Fetch(ctx, results, step, key, func() (entry, bool, error) {
+		value, info, err := compute()
+		return entry{Value: value, Step: info}, !info.Fallback, err
+	})
+	if hit {
+		// Nothing was spent on this request
+		cached.Step.Cached = true
+		cached.Step.Tokens = nil
+	}
+	return cached.Value, cached.Step, err
+}
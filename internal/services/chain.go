@@ -2,81 +2,353 @@ package services
 
 import (
     "context"
+    "errors"
     "fmt"
+    "sync"
 	"time"
     "github.com/sirupsen/logrus"
+    "golang.org/x/sync/singleflight"
     "github.com/harshaSenaratne/reword/internal/models"
+    "github.com/harshaSenaratne/reword/internal/pii"
+    "github.com/harshaSenaratne/reword/internal/policy"
+    "github.com/harshaSenaratne/reword/internal/prefilter"
+    "github.com/harshaSenaratne/reword/internal/usage"
+    "github.com/harshaSenaratne/reword/pkg/llm"
 )
 
 type ChainService struct {
     assistant *AssistantService
     moderator *ModeratorService
+    policy    *policy.Policy
+    filter    *prefilter.Filter
+    detector  *pii.Detector
+    ledger    *usage.Ledger
+    notifier  Notifier
+    inflight  singleflight.Group
+    runsMu    sync.Mutex
+    runs      map[string]*sharedRun
     logger    *logrus.Logger
 }
 
-func NewChainService(assistant *AssistantService, moderator *ModeratorService, logger *logrus.Logger) *ChainService {
+// sharedRun is the context of a coalesced chain run, cancelled once every
+// caller waiting on it has gone away
+type sharedRun struct {
+    ctx     context.Context
+    cancel  context.CancelFunc
+    waiters int
+}
+
+// Notifier is told about moderation outcomes clients can subscribe to. Notify
+// is called on the request path, so it must not block.
+type Notifier interface {
+    Notify(tenant, event string, data any)
+}
+
+// detector and notifier may be nil
+func NewChainService(assistant *AssistantService, moderator *ModeratorService, policy *policy.Policy, filter *prefilter.Filter, detector *pii.Detector, ledger *usage.Ledger, notifier Notifier, logger *logrus.Logger) *ChainService {
     return &ChainService{
         assistant: assistant,
         moderator: moderator,
+        policy:    policy,
+        filter:    filter,
+        detector:  detector,
+        ledger:    ledger,
+        notifier:  notifier,
+        runs:      make(map[string]*sharedRun),
         logger:    logger,
     }
 }
 
-// processes a comment through the complete chain
+// processes a comment through the complete chain. Concurrent requests of one
+// tenant for the same comment and sentiment share a single run.
 func (s *ChainService) ProcessComment(ctx context.Context, req *models.CommentRequest) (*models.ModeratedResponse, error) {
+    // Replies depend on the conversation, so only context-free comments are shared
+    if len(req.History) > 0 {
+        response, err := s.processComment(ctx, req, nil)
+        if err == nil {
+            s.announce(req, response)
+        }
+        return response, err
+    }
+
+    // Runs are billed to the tenant that started them, so tenants never share one
+    key := req.Tenant + "\x00" + req.Sentiment + "\x00" + req.Comment
+
+    // The shared run must not die with whichever caller happened to start it,
+    // only when nobody is left waiting for it
+    run := s.joinRun(ctx, key)
+    defer s.leaveRun(key, run)
+
+    executed := false
+    resultChan := s.inflight.DoChan(key, func() (interface{}, error) {
+        executed = true
+        return s.processComment(run.ctx, req, nil)
+    })
+
+    select {
+    case <-ctx.Done():
+        return nil, ctx.Err()
+    case result := <-resultChan:
+        if result.Err != nil {
+            return nil, result.Err
+        }
+        if !executed {
+            coalescedTotal.Inc()
+            s.logger.WithField("user_id", req.UserID).Debug("Joined in-flight processing of identical comment")
+        }
+
+        // Each waiter gets its own copy of the shared response
+        response := *result.Val.(*models.ModeratedResponse)
+        if !executed {
+            // The run was billed to whoever started it
+            response.Steps = unbilled(response.Steps)
+            response.Tokens = models.TokenUsage{}
+            response.CostUSD = 0
+        }
+        // Every caller's tenant hears about its own comment
+        s.announce(req, &response)
+        return &response, nil
+    }
+}
+
+func (s *ChainService) joinRun(ctx context.Context, key string) *sharedRun {
+    s.runsMu.Lock()
+    defer s.runsMu.Unlock()
+
+    run, ok := s.runs[key]
+    if !ok {
+        runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+        run = &sharedRun{ctx: runCtx, cancel: cancel}
+        s.runs[key] = run
+    }
+    run.waiters++
+    return run
+}
+
+func (s *ChainService) leaveRun(key string, run *sharedRun) {
+    s.runsMu.Lock()
+    defer s.runsMu.Unlock()
+
+    run.waiters--
+    if run.waiters > 0 {
+        return
+    }
+    run.cancel()
+    delete(s.runs, key)
+    // A caller arriving now must start over rather than join the cancelled run
+    s.inflight.Forget(key)
+}
+
+// Observer follows a chain run stage by stage, then receives the reply as it is written
+type Observer interface {
+    Stage(event string, data any)
+    llm.StreamHandler
+}
+
+// processes a comment like ProcessComment, reporting every stage to observer.
+// Streamed runs are never coalesced since each caller needs its own stream.
+func (s *ChainService) ProcessCommentStream(ctx context.Context, req *models.CommentRequest, observer Observer) (*models.ModeratedResponse, error) {
+    response, err := s.processComment(ctx, req, observer)
+    if err == nil {
+        s.announce(req, response)
+    }
+    return response, err
+}
+
+// tells the notifier about comments that were rewritten, withheld or escalated
+func (s *ChainService) announce(req *models.CommentRequest, response *models.ModeratedResponse) {
+    if s.notifier == nil {
+        return
+    }
+
+    var event string
+    switch response.Action {
+    case models.ActionRewrite, models.ActionMask:
+        if !response.WasModified {
+            return
+        }
+        event = models.WebhookCommentRewritten
+    case models.ActionBlock, models.ActionHold:
+        event = models.WebhookCommentBlocked
+    case models.ActionEscalate:
+        event = models.WebhookEscalationRaised
+    default:
+        return
+    }
+
+    s.notifier.Notify(req.Tenant, event, models.CommentEvent{
+        UserID:           req.UserID,
+        OriginalComment:  response.OriginalComment,
+        ModeratedInput:   response.ModeratedInput,
+        Action:           response.Action,
+        PolicyRule:       response.PolicyRule,
+        ModerationReason: response.ModerationReason,
+        Toxicity:         response.Toxicity,
+    })
+}
+
+func (s *ChainService) processComment(ctx context.Context, req *models.CommentRequest, observer Observer) (*models.ModeratedResponse, error) {
     startTime := time.Now()
-    
+
+    // Personal data never leaves our side: models, caches and logs only see
+    // placeholders. The whole comment is redacted before it is cut down, so
+    // the cut can't split a value and leave the rest of it undetected.
+    redaction := s.detector.Redact(req.Comment)
+
+    // Keep oversized comments away from the models
+    input, truncated, err := s.moderator.FitBudget(redaction.Text)
+    if err != nil {
+        return nil, err
+    }
+    if truncated {
+        input = pii.TrimPartial(input)
+    }
+    // comment is what was kept of the comment as written
+    comment := redaction.Restore(input, func(string) bool { return true })
+
     s.logger.WithFields(logrus.Fields{
-        "comment":   req.Comment,
+        "comment":   input,
         "sentiment": req.Sentiment,
         "user_id":   req.UserID,
     }).Info("Processing comment")
 
-    // Step 1: Check toxicity of incoming comment
-    isToxic, toxicityReason, err := s.moderator.CheckToxicity(ctx, req.Comment)
-    if err != nil {
-        s.logger.WithError(err).Warn("Failed to check toxicity, continuing")
+    steps := make(map[string]models.StepInfo)
+    degraded := false
+
+    // Step 1: Settle obvious comments locally, otherwise check toxicity with the model
+    var verdict *models.ToxicityVerdict
+    var step models.StepInfo
+    if match := s.prefilter(comment); match != nil {
+        verdict = match.Verdict
+        steps[models.StepPrefilter] = models.StepInfo{Model: models.StepPrefilter, Rule: match.Rule}
+        notify(observer, models.EventToxicity, verdict)
+    } else {
+        verdict, step, err = s.moderator.CheckToxicity(ctx, input)
+        if errors.Is(err, llm.ErrOverloaded) {
+            // Shed the request rather than piling more work on a saturated model
+            return nil, err
+        }
+        if err != nil {
+            s.logger.WithError(err).Warn("Failed to check toxicity, continuing")
+            degraded = true
+        } else {
+            steps[models.StepToxicity] = step
+            notify(observer, models.EventToxicity, verdict)
+        }
+    }
+
+    // Step 2: Let the policy decide what happens to the comment
+    decision := s.policy.Evaluate(verdict)
+    s.logger.WithFields(logrus.Fields{
+        "action": decision.Action,
+        "rule":   decision.Rule,
+    }).Debug("Policy decision")
+    notify(observer, models.EventDecision, models.DecisionEvent{Action: decision.Action, PolicyRule: decision.Rule})
+
+    response := &models.ModeratedResponse{
+        OriginalComment: req.Comment,
+        Toxicity:        verdict,
+        Action:          decision.Action,
+        PolicyRule:      decision.Rule,
+        Steps:           steps,
+        Truncated:       truncated,
+        PII:             s.findings(redaction),
+    }
+    if verdict != nil {
+        response.ModerationReason = verdict.Reason
     }
 
-    // Step 2: If comment is toxic, moderate it first
-    moderatedInput := req.Comment
+    // prompted is what the models work on, moderatedInput what the client gets back
+    prompted := input
+    moderatedInput := comment
     wasModified := false
-    if isToxic {
-        moderatedInput, wasModified, err = s.moderator.ModerateComment(ctx, req.Comment)
+    switch decision.Action {
+    case models.ActionRewrite:
+        prompted, _, step, err = s.moderator.ModerateComment(ctx, input)
         if err != nil {
             return nil, fmt.Errorf("failed to moderate input comment: %w", err)
         }
+        steps[models.StepModeration] = step
+        moderatedInput, wasModified = s.restore(redaction, comment, prompted)
+    case models.ActionMask:
+        prompted, _, step, err = s.moderator.MaskComment(ctx, input)
+        if err != nil {
+            return nil, fmt.Errorf("failed to mask input comment: %w", err)
+        }
+        steps[models.StepModeration] = step
+        moderatedInput, wasModified = s.restore(redaction, comment, prompted)
+    case models.ActionBlock, models.ActionHold, models.ActionEscalate:
+        // Nothing is published or replied to until a human looks at it
+        response.Degraded = degraded || hasFallback(steps)
+        response.SemanticReuse = hasSemanticReuse(steps)
+        response.Tokens = totalTokens(steps)
+        response.Timestamp = time.Now()
+        s.ledger.Charge(req.UserID, req.Tenant, response)
         s.logger.WithFields(logrus.Fields{
-            "original_input":  req.Comment,
-            "moderated_input": moderatedInput,
-            "was_modified":    wasModified,
+            "processing_time": time.Since(startTime),
+            "action":          decision.Action,
+            "rule":            decision.Rule,
+        }).Info("Comment withheld by policy")
+        return response, nil
+    }
+
+    notify(observer, models.EventModerated, models.ModeratedEvent{ModeratedInput: moderatedInput, WasModified: wasModified})
+
+    if wasModified {
+        s.logger.WithFields(logrus.Fields{
+            "original_input":  input,
+            "moderated_input": prompted,
+            "action":          decision.Action,
         }).Info("Input comment was moderated")
     }
 
     // Step 3: Analyze sentiment if not provided - use the moderated input
     sentiment := req.Sentiment
     if sentiment == "" {
-        sentiment, err = s.assistant.AnalyzeSentiment(ctx, moderatedInput)
+        sentiment, step, err = s.assistant.AnalyzeSentiment(ctx, prompted)
+        if errors.Is(err, llm.ErrOverloaded) {
+            return nil, err
+        }
         if err != nil {
             s.logger.WithError(err).Warn("Failed to analyze sentiment, using default")
             sentiment = "helpful"
+        } else {
+            steps[models.StepSentiment] = step
         }
     }
+    notify(observer, models.EventSentiment, models.SentimentEvent{Sentiment: sentiment})
 
     // Step 4: Generate assistant response based on the moderated input
-    assistantResponse, err := s.assistant.GenerateResponse(ctx, sentiment, moderatedInput)
+    history := redactHistory(redaction, req.History)
+    var assistantResponse string
+    if observer != nil {
+        stream := &replyStream{observer: observer, restorer: redaction.Restorer(s.policy.RestorePII)}
+        assistantResponse, step, err = s.assistant.StreamResponse(ctx, sentiment, prompted, history, stream)
+        if err == nil {
+            if stream.streamed {
+                err = stream.Flush()
+            } else {
+                // Cached replies arrive whole
+                err = observer.Chunk(redaction.Restore(assistantResponse, s.policy.RestorePII))
+            }
+        }
+    } else {
+        assistantResponse, step, err = s.assistant.GenerateResponse(ctx, sentiment, prompted, history)
+    }
     if err != nil {
         return nil, fmt.Errorf("failed to generate assistant response: %w", err)
     }
+    steps[models.StepReply] = step
+    assistantResponse = redaction.Restore(assistantResponse, s.policy.RestorePII)
 
     // Build response
-    response := &models.ModeratedResponse{
-        OriginalComment:  req.Comment,
-        AssistantReply:   assistantResponse,
-        WasModified:      wasModified,
-        ModerationReason: toxicityReason,
-        Timestamp:        time.Now(),
-    }
+    response.AssistantReply = assistantResponse
+    response.WasModified = wasModified
+    response.Degraded = degraded || hasFallback(steps)
+    response.SemanticReuse = hasSemanticReuse(steps)
+    response.Tokens = totalTokens(steps)
+    response.Timestamp = time.Now()
+    s.ledger.Charge(req.UserID, req.Tenant, response)
 
     // Include moderated input only if it was actually modified
     if wasModified {
@@ -86,39 +358,141 @@ func (s *ChainService) ProcessComment(ctx context.Context, req *models.CommentRe
     s.logger.WithFields(logrus.Fields{
         "processing_time": time.Since(startTime),
         "was_modified":    response.WasModified,
+        "action":          response.Action,
+        "degraded":        response.Degraded,
+        "cost_usd":        response.CostUSD,
     }).Info("Comment processed successfully")
 
     return response, nil
 }
 
-// processes multiple comments concurrently
-func (s *ChainService) ProcessBatch(ctx context.Context, requests []*models.CommentRequest) ([]*models.ModeratedResponse, error) {
-    responses := make([]*models.ModeratedResponse, len(requests))
-    errChan := make(chan error, len(requests))
-    
-    for i, req := range requests {
-        go func(index int, request *models.CommentRequest) {
-            response, err := s.ProcessComment(ctx, request)
-            if err != nil {
-                errChan <- err
-                return
-            }
-            responses[index] = response
-            errChan <- nil
-        }(i, req)
+// runs the local pre-filter, returning nil when the comment needs the model
+func (s *ChainService) prefilter(comment string) *prefilter.Match {
+    if s.filter == nil || !s.filter.Enabled() {
+        return nil
+    }
+
+    match := s.filter.Check(comment)
+    if match == nil {
+        prefilterTotal.WithLabelValues("pass", "").Inc()
+        return nil
+    }
+    prefilterTotal.WithLabelValues(match.Verdict.Verdict, match.Rule).Inc()
+    s.logger.WithFields(logrus.Fields{
+        "verdict": match.Verdict.Verdict,
+        "rule":    match.Rule,
+    }).Debug("Comment settled by pre-filter")
+    return match
+}
+
+// reports the personal data redacted from a comment and what the policy does with it
+func (s *ChainService) findings(redaction *pii.Redaction) []models.PIIFinding {
+    findings := redaction.Findings
+    for i := range findings {
+        findings[i].Handling = s.policy.PIIHandling(findings[i].Type)
+        piiRedactedTotal.WithLabelValues(findings[i].Type).Inc()
+    }
+    return findings
+}
+
+// puts personal data back into a rewrite where the policy allows, reporting
+// whether the result differs from the comment
+func (s *ChainService) restore(redaction *pii.Redaction, comment, rewritten string) (string, bool) {
+    restored := redaction.Restore(rewritten, s.policy.RestorePII)
+    return restored, restored != comment
+}
+
+// redacts earlier turns of the conversation with the comment's placeholders
+func redactHistory(redaction *pii.Redaction, history []models.Message) []models.Message {
+    if len(history) == 0 {
+        return history
+    }
+    redacted := make([]models.Message, len(history))
+    for i, message := range history {
+        message.Content = redaction.Also(message.Content)
+        redacted[i] = message
     }
+    return redacted
+}
+
+// a response is degraded when any step was skipped or served by a fallback model
+func hasFallback(steps map[string]models.StepInfo) bool {
+    for _, info := range steps {
+        if info.Fallback {
+            return true
+        }
+    }
+    return false
+}
 
-    // Wait for all goroutines to complete
-    var firstError error
-    for i := 0; i < len(requests); i++ {
-        if err := <-errChan; err != nil && firstError == nil {
-            firstError = err
+// reports whether any step reused the result of a near-duplicate comment
+func hasSemanticReuse(steps map[string]models.StepInfo) bool {
+    for _, info := range steps {
+        if info.Similarity > 0 {
+            return true
         }
     }
+    return false
+}
+
+func notify(observer Observer, event string, data any) {
+    if observer != nil {
+        observer.Stage(event, data)
+    }
+}
+
+// replyStream notes whether the model streamed anything before passing it on,
+// with personal data restored where the policy allows
+type replyStream struct {
+    observer Observer
+    restorer *pii.Restorer
+    streamed bool
+}
+
+func (r *replyStream) Chunk(text string) error {
+    r.streamed = true
+    if text = r.restorer.Write(text); text == "" {
+        return nil
+    }
+    return r.observer.Chunk(text)
+}
 
-    if firstError != nil {
-        return nil, firstError
+// sends whatever was held back waiting for the rest of a placeholder
+func (r *replyStream) Flush() error {
+    if text := r.restorer.Flush(); text != "" {
+        return r.observer.Chunk(text)
     }
+    return nil
+}
 
-    return responses, nil
-}
\ No newline at end of file
+func (r *replyStream) Reset() {
+    r.streamed = false
+    r.restorer.Reset()
+    r.observer.Reset()
+}
+
+// sums the tokens spent by every step
+func totalTokens(steps map[string]models.StepInfo) models.TokenUsage {
+    var total models.TokenUsage
+    for _, info := range steps {
+        if info.Tokens != nil {
+            total = total.Add(*info.Tokens)
+        }
+        if info.Embedding != nil && info.Embedding.Tokens != nil {
+            total = total.Add(*info.Embedding.Tokens)
+        }
+    }
+    return total
+}
+
+// copies steps without their spend, for callers that joined another's run
+func unbilled(steps map[string]models.StepInfo) map[string]models.StepInfo {
+    copied := make(map[string]models.StepInfo, len(steps))
+    for name, info := range steps {
+        info.Tokens = nil
+        info.CostUSD = 0
+        info.Embedding = nil
+        copied[name] = info
+    }
+    return copied
+}
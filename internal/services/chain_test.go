@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/harshaSenaratne/reword/internal/pii"
+	"github.com/harshaSenaratne/reword/internal/policy"
+	"github.com/harshaSenaratne/reword/internal/prefilter"
+	"github.com/harshaSenaratne/reword/internal/usage"
+	"github.com/harshaSenaratne/reword/pkg/llm"
+)
+
+// slowToxicity holds the toxicity check back long enough for callers to pile up
+var slowToxicity = []llm.FakeRule{
+	{Match: `(?s)Analyze if the following comment`, Response: `{"verdict": "clean", "scores": {}, "confidence": 0.9, "reason": "fine"}`, DelayMS: 200},
+}
+
+func newTestChain(t *testing.T, rules []llm.FakeRule) (*ChainService, *usage.Ledger) {
+	t.Helper()
+	moderator, _ := newTestModerator(t, rules)
+	assistant := NewAssistantService(moderator.llmClient, nil, moderator.logger)
+	ledger := usage.NewLedger(usage.Default(), []string{"acme", "globex"}, 0)
+	chain := NewChainService(assistant, moderator, policy.Default(), prefilter.Default(), nil, ledger, nil, moderator.logger)
+	return chain, ledger
+}
+
+func TestProcessCommentCoalescesIdenticalRequests(t *testing.T) {
+	chain, ledger := newTestChain(t, slowToxicity)
+
+	const callers = 5
+	responses := make([]*models.ModeratedResponse, callers)
+	errs := make([]error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = chain.ProcessComment(context.Background(), &models.CommentRequest{Comment: "the parcel arrived", Tenant: "acme"})
+		}(i)
+	}
+	wg.Wait()
+
+	billed := 0
+	for i, response := range responses {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if response.Tokens.Total > 0 {
+			billed++
+		}
+	}
+	if billed != 1 {
+		t.Errorf("%d callers billed, want 1", billed)
+	}
+	// The provider was only called for one run
+	if report := ledger.Report("acme"); report.Total.Requests != 1 {
+		t.Errorf("%d runs charged, want 1", report.Total.Requests)
+	}
+
+	// Once the run is over the next caller starts a new one
+	if _, err := chain.ProcessComment(context.Background(), &models.CommentRequest{Comment: "the parcel arrived", Tenant: "acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if report := ledger.Report("acme"); report.Total.Requests != 2 {
+		t.Errorf("%d runs charged, want 2", report.Total.Requests)
+	}
+}
+
+func TestProcessCommentCancelledCallerKeepsRunAlive(t *testing.T) {
+	chain, _ := newTestChain(t, slowToxicity)
+	req := &models.CommentRequest{Comment: "the parcel arrived", Tenant: "acme"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := chain.ProcessComment(ctx, req)
+		first <- err
+	}()
+
+	// Join the run the first caller started, then let the first caller go
+	time.Sleep(20 * time.Millisecond)
+	joined := make(chan error, 1)
+	var response *models.ModeratedResponse
+	go func() {
+		var err error
+		response, err = chain.ProcessComment(context.Background(), req)
+		joined <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller: %v, want context.Canceled", err)
+	}
+	if err := <-joined; err != nil {
+		t.Fatalf("joiner: %v", err)
+	}
+	if response.Action != models.ActionAllow || response.AssistantReply == "" {
+		t.Errorf("joiner got %+v", response)
+	}
+}
+
+func TestProcessCommentLastCallerCancelsRun(t *testing.T) {
+	chain, _ := newTestChain(t, slowToxicity)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := chain.ProcessComment(ctx, &models.CommentRequest{Comment: "the parcel arrived"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the deadline", err)
+	}
+
+	chain.runsMu.Lock()
+	defer chain.runsMu.Unlock()
+	if len(chain.runs) != 0 {
+		t.Errorf("%d runs left behind", len(chain.runs))
+	}
+}
+
+func TestProcessCommentNeverCoalescesAcrossTenants(t *testing.T) {
+	chain, ledger := newTestChain(t, slowToxicity)
+
+	var wg sync.WaitGroup
+	for _, tenant := range []string{"acme", "globex"} {
+		wg.Add(1)
+		go func(tenant string) {
+			defer wg.Done()
+			response, err := chain.ProcessComment(context.Background(), &models.CommentRequest{Comment: "the parcel arrived", Tenant: tenant})
+			if err != nil {
+				t.Errorf("%s: %v", tenant, err)
+				return
+			}
+			if response.Tokens.Total == 0 {
+				t.Errorf("%s was not billed", tenant)
+			}
+		}(tenant)
+	}
+	wg.Wait()
+
+	for _, tenant := range []string{"acme", "globex"} {
+		if report := ledger.Report(tenant); report.Total.Requests != 1 {
+			t.Errorf("%s: %d runs charged, want 1", tenant, report.Total.Requests)
+		}
+	}
+}
+
+func TestProcessCommentRedactsBeforeTruncating(t *testing.T) {
+	// Seven tokens cut the comment inside the address, leaving "jane.doe@example"
+	// that no longer reads as an email
+	t.Setenv("INPUT_TOKEN_BUDGET", "7")
+	t.Setenv("INPUT_BUDGET_MODE", "truncate")
+	chain, _ := newTestChain(t, []llm.FakeRule{
+		{Match: `(?s)Analyze if the following comment.*(jane|doe|example|\[EMAIL)`, Response: `{"verdict": "clean", "scores": {}, "confidence": 0.9, "reason": "saw part of the address"}`},
+		{Match: `(?s)Analyze if the following comment`, Response: `{"verdict": "clean", "scores": {}, "confidence": 0.9, "reason": "fine"}`},
+	})
+	detector, err := pii.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.detector = detector
+
+	response, err := chain.ProcessComment(context.Background(), &models.CommentRequest{Comment: "Please write to jane.doe@example.com about my order"})
+	if err != nil {
+		t.Fatalf("ProcessComment: %v", err)
+	}
+	if !response.Truncated {
+		t.Fatal("comment was not truncated")
+	}
+	if response.Toxicity == nil || response.Toxicity.Reason != "fine" {
+		t.Errorf("the model was shown part of the address: %+v", response.Toxicity)
+	}
+	if len(response.PII) != 1 || response.PII[0].Type != models.PIIEmail {
+		t.Errorf("findings %+v, want the email", response.PII)
+	}
+}
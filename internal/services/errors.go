@@ -0,0 +1,6 @@
+package services
+
+import "errors"
+
+// ErrInvalidItem is reported for a batch, stream or job item that isn't a comment
+var ErrInvalidItem = errors.New("item must be a comment object")
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	coalescedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "reword_coalesced_requests_total",
+		Help: "Comments served by joining an identical in-flight chain run",
+	})
+
+	overBudgetTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_input_over_budget_total",
+		Help: "Comments exceeding the input token budget by outcome (rejected, truncated)",
+	}, []string{"outcome"})
+
+	prefilterTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_prefilter_total",
+		Help: "Comments seen by the local pre-filter by outcome (toxic, clean, pass) and the rule that fired",
+	}, []string{"outcome", "rule"})
+
+	piiRedactedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_pii_redacted_total",
+		Help: "Personal data values replaced with placeholders before prompting, by type",
+	}, []string{"type"})
+)
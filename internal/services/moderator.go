@@ -2,47 +2,108 @@ package services
 
 import (
     "context"
+    "errors"
     "fmt"
     "strings"
     
     "github.com/sirupsen/logrus"
+    "github.com/tmc/langchaingo/llms"
+    "github.com/harshaSenaratne/reword/internal/cache"
+    "github.com/harshaSenaratne/reword/internal/config"
+    "github.com/harshaSenaratne/reword/internal/models"
+    "github.com/harshaSenaratne/reword/internal/normalize"
     "github.com/harshaSenaratne/reword/pkg/llm"
 )
 
 type ModeratorService struct {
     llmClient *llm.Client
+    config    *config.Config
+    results   *cache.Results
+    semantic  *cache.Semantic
     logger    *logrus.Logger
 }
 
-func NewModeratorService(llmClient *llm.Client, logger *logrus.Logger) *ModeratorService {
+func NewModeratorService(llmClient *llm.Client, cfg *config.Config, results *cache.Results, semantic *cache.Semantic, logger *logrus.Logger) *ModeratorService {
     return &ModeratorService{
         llmClient: llmClient,
+        config:    cfg,
+        results:   results,
+        semantic:  semantic,
         logger:    logger,
     }
 }
 
+// ErrInputTooLong is returned for comments over the input token budget in reject mode
+var ErrInputTooLong = errors.New("comment exceeds the input token budget")
+
+// checks a comment against the input token budget before any model sees it,
+// truncating or rejecting it depending on the configured mode
+func (s *ModeratorService) FitBudget(comment string) (string, bool, error) {
+    budget := s.config.InputTokenBudget
+    if budget <= 0 {
+        return comment, false, nil
+    }
+
+    tokens := s.llmClient.CountTokens(llm.RoleModerator, comment)
+    if tokens <= budget {
+        return comment, false, nil
+    }
+
+    if s.config.InputBudgetMode != "truncate" {
+        overBudgetTotal.WithLabelValues("rejected").Inc()
+        return "", false, fmt.Errorf("%w: %d tokens, budget is %d", ErrInputTooLong, tokens, budget)
+    }
+
+    overBudgetTotal.WithLabelValues("truncated").Inc()
+    s.logger.WithFields(logrus.Fields{
+        "tokens": tokens,
+        "budget": budget,
+    }).Info("Truncating comment to the input token budget")
+    return s.llmClient.TruncateTokens(llm.RoleModerator, comment, budget), true, nil
+}
+
 // cleans up inappropriate content
-func (s *ModeratorService) ModerateComment(ctx context.Context, comment string) (string, bool, error) {
-    prompt := s.buildModerationPrompt(comment)
-    
-    s.logger.WithField("comment", comment).Debug("Moderating comment")
+func (s *ModeratorService) ModerateComment(ctx context.Context, comment string) (string, bool, models.StepInfo, error) {
+    return s.rewrite(ctx, comment, "rewrite", moderationPromptVersion, s.buildModerationPrompt(comment))
+}
+
+// replaces offensive words with asterisks, leaving the rest of the comment untouched
+func (s *ModeratorService) MaskComment(ctx context.Context, comment string) (string, bool, models.StepInfo, error) {
+    return s.rewrite(ctx, comment, "mask", maskPromptVersion, s.buildMaskPrompt(comment))
+}
 
-    response, err := s.llmClient.GenerateResponse(ctx, s.llmClient.GetModeratorLLM(), prompt)
+func (s *ModeratorService) rewrite(ctx context.Context, comment, mode, version, prompt string) (string, bool, models.StepInfo, error) {
+    text, similarity, embedding := s.cacheText(ctx, comment)
+    inputs := []string{mode, text}
+    moderatedComment, step, err := fetchStep(ctx, s.results, s.llmClient, llm.RoleModerator, models.StepModeration, version, inputs, func() (string, models.StepInfo, error) {
+        s.logger.WithField("comment", comment).Debug("Moderating comment")
+
+        generation, err := s.llmClient.Generate(ctx, llm.RoleModerator, prompt)
+        if err != nil {
+            s.logger.WithError(err).Error("Failed to moderate comment")
+            return "", models.StepInfo{}, fmt.Errorf("moderation failed: %w", err)
+        }
+        return strings.TrimSpace(generation.Text), stepInfo(generation), nil
+    })
     if err != nil {
-        s.logger.WithError(err).Error("Failed to moderate comment")
-        return "", false, fmt.Errorf("moderation failed: %w", err)
+        return "", false, models.StepInfo{}, err
+    }
+    if step.Cached {
+        step.Similarity = similarity
     }
+    step.Embedding = embedding
 
-    moderatedComment := strings.TrimSpace(response)
     wasModified := moderatedComment != comment
 
     s.logger.WithFields(logrus.Fields{
         "original":     comment,
         "moderated":    moderatedComment,
         "was_modified": wasModified,
+        "model":        step.Model,
+        "cached":       step.Cached,
     }).Debug("Comment moderated")
 
-    return moderatedComment, wasModified, nil
+    return moderatedComment, wasModified, step, nil
 }
 
 func (s *ModeratorService) buildModerationPrompt(comment string) string {
@@ -66,27 +127,132 @@ Moderated comment:`
     return fmt.Sprintf(template, comment)
 }
 
-//  checks if a comment is toxic
-func (s *ModeratorService) CheckToxicity(ctx context.Context, comment string) (bool, string, error) {
-    prompt := fmt.Sprintf(`Analyze if the following comment contains toxicity, rudeness, or inappropriate content.
-    Respond with "YES" or "NO" followed by a brief reason.
-    
-    Comment: "%s"
-    
-    Analysis:`, comment)
+func (s *ModeratorService) buildMaskPrompt(comment string) string {
+    template := `You are the moderator of an online forum. Mask offensive words in the comment below.
 
-    response, err := s.llmClient.GenerateResponse(ctx, s.llmClient.GetModeratorLLM(), prompt)
+Your task:
+1. Replace every profane, abusive, or offensive word with asterisks of the same length
+2. Keep every other word, the punctuation and the word order exactly as written
+3. If nothing needs masking, return the comment exactly as is
+
+Original comment: "%s"
+
+Masked comment:`
+
+    return fmt.Sprintf(template, comment)
+}
+
+//  checks if a comment is toxic, asking for a JSON verdict and re-prompting
+//  with the validation error when the model returns malformed output
+func (s *ModeratorService) CheckToxicity(ctx context.Context, comment string) (*models.ToxicityVerdict, models.StepInfo, error) {
+    // The model judges what the comment says, not how it was disguised, and
+    // disguised variants share a cache entry
+    if s.config.NormalizeInput {
+        comment = normalize.Apply(comment, normalize.Default()).Normalized
+    }
+    text, similarity, embedding := s.cacheText(ctx, comment)
+    verdict, step, err := fetchStep(ctx, s.results, s.llmClient, llm.RoleModerator, models.StepToxicity, toxicityPromptVersion, []string{text}, func() (*models.ToxicityVerdict, models.StepInfo, error) {
+        return s.checkToxicity(ctx, comment)
+    })
+    if step.Cached {
+        step.Similarity = similarity
+    }
+    step.Embedding = embedding
+    return verdict, step, err
+}
+
+// resolves the text a comment's results are cached under. With the semantic
+// cache enabled a near-duplicate of an earlier comment shares that comment's
+// entries; similarity is 0 unless such a match was found. The embedding step
+// is nil unless the embedding model was called for this lookup.
+func (s *ModeratorService) cacheText(ctx context.Context, comment string) (string, float64, *models.StepInfo) {
+    normalized := cache.Normalize(comment)
+    if s.semantic == nil || s.results == nil {
+        return normalized, 0, nil
+    }
+
+    var embedding *models.StepInfo
+    key := cache.Key("embedding", s.llmClient.EmbeddingModel(), "v1", normalized)
+    vector, _, err := cache.Fetch(ctx, s.results, "embedding", key, func() ([]float32, bool, error) {
+        vector, usage, err := s.llmClient.Embed(ctx, normalized)
+        if err == nil {
+            embedding = &models.StepInfo{Model: s.llmClient.EmbeddingModel(), Tokens: tokenUsage(usage)}
+        }
+        return vector, true, err
+    })
     if err != nil {
-        return false, "", err
+        s.logger.WithError(err).Warn("Failed to embed comment, skipping semantic cache")
+        return normalized, 0, embedding
     }
 
-    response = strings.TrimSpace(response)
-    isToxic := strings.HasPrefix(strings.ToUpper(response), "YES")
-    
-    reason := ""
-    if parts := strings.SplitN(response, " ", 2); len(parts) > 1 {
-        reason = parts[1]
+    match, similarity, ok := s.semantic.Nearest(vector)
+    if !ok {
+        s.semantic.Add(normalized, vector)
+        return normalized, 0, embedding
+    }
+    if match == normalized {
+        return normalized, 0, embedding
+    }
+
+    s.logger.WithFields(logrus.Fields{
+        "similarity": similarity,
+    }).Debug("Comment matched a near-duplicate in the semantic cache")
+    return match, similarity, embedding
+}
+
+func (s *ModeratorService) checkToxicity(ctx context.Context, comment string) (*models.ToxicityVerdict, models.StepInfo, error) {
+    prompt := s.buildToxicityPrompt(comment)
+
+    var options []llms.CallOption
+    if s.config.ToxicityJSONMode {
+        options = append(options, llms.WithJSONMode())
     }
 
-    return isToxic, reason, nil
-}
\ No newline at end of file
+    // Repair attempts are billed too, so the step reports their sum
+    var lastErr error
+    var usage llm.TokenUsage
+    for attempt := 0; attempt <= s.config.ToxicityRepairAttempts; attempt++ {
+        generation, err := s.llmClient.Generate(ctx, llm.RoleModerator, prompt, options...)
+        if err != nil {
+            return nil, models.StepInfo{}, err
+        }
+        usage = usage.Add(generation.Usage)
+
+        verdict, err := parseVerdict(generation.Text)
+        if err == nil {
+            step := stepInfo(generation)
+            step.Tokens = tokenUsage(usage)
+            return verdict, step, nil
+        }
+
+        s.logger.WithError(err).WithFields(logrus.Fields{
+            "attempt":  attempt + 1,
+            "response": generation.Text,
+        }).Warn("Malformed toxicity verdict")
+        lastErr = err
+        prompt = s.buildRepairPrompt(comment, generation.Text, err)
+    }
+
+    return nil, models.StepInfo{}, fmt.Errorf("toxicity check failed: %w", lastErr)
+}
+
+func (s *ModeratorService) buildToxicityPrompt(comment string) string {
+    template := `Analyze if the following comment contains toxicity, rudeness, or inappropriate content.
+Respond with only a JSON object matching this schema, and nothing else:
+%s
+
+Comment: "%s"
+
+JSON:`
+
+    schema := fmt.Sprintf(verdictSchema, verdictScoresSchema())
+    return fmt.Sprintf(template, schema, comment)
+}
+
+func (s *ModeratorService) buildRepairPrompt(comment, previous string, parseErr error) string {
+    return fmt.Sprintf(`%s
+
+Your previous answer was rejected: %v
+Previous answer: %s
+Respond again with only the corrected JSON object.`, s.buildToxicityPrompt(comment), parseErr, compactOutput(previous))
+}
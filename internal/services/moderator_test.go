@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/harshaSenaratne/reword/internal/cache"
+	"github.com/harshaSenaratne/reword/internal/config"
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/harshaSenaratne/reword/pkg/llm"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestModerator answers moderator prompts with rules, or the fake
+// provider's defaults when rules is nil
+func newTestModerator(t *testing.T, rules []llm.FakeRule) (*ModeratorService, *config.Config) {
+	t.Helper()
+	t.Setenv("ASSISTANT_PROVIDER", "fake")
+	t.Setenv("MODERATOR_PROVIDER", "fake")
+	t.Setenv("CACHE_ENABLED", "false")
+	if rules != nil {
+		data, err := json.Marshal(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "rules.json")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("MODERATOR_RULES_FILE", path)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	client, err := llm.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewModeratorService(client, cfg, nil, nil, logger), cfg
+}
+
+func TestCheckToxicityRepairsMalformedVerdict(t *testing.T) {
+	valid := `{"verdict": "toxic", "scores": {"harassment": 0.8}, "confidence": 0.9, "reason": "insult"}`
+	tests := []struct {
+		name    string
+		rules   []llm.FakeRule
+		wantErr bool
+	}{
+		{"repaired on the second attempt", []llm.FakeRule{
+			{Match: `(?s)Your previous answer was rejected: .*unknown category "rudeness"`, Response: valid},
+			{Match: `(?s)Analyze if the following comment`, Response: `{"verdict": "toxic", "scores": {"rudeness": 0.9}, "confidence": 0.9, "reason": ""}`},
+		}, false},
+		{"still malformed after the repair", []llm.FakeRule{
+			{Match: `(?s)Analyze if the following comment`, Response: `The comment is toxic.`},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moderator, cfg := newTestModerator(t, tt.rules)
+			if cfg.ToxicityRepairAttempts != 1 {
+				t.Fatalf("%d repair attempts, want the default of 1", cfg.ToxicityRepairAttempts)
+			}
+
+			verdict, step, err := moderator.checkToxicity(context.Background(), "you idiot")
+			if tt.wantErr {
+				if !errors.Is(err, errMalformedVerdict) {
+					t.Fatalf("got %+v, %v, want a malformed verdict error", verdict, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkToxicity: %v", err)
+			}
+			if verdict.Verdict != models.VerdictToxic || verdict.Scores["harassment"] != 0.8 {
+				t.Errorf("unexpected verdict %+v", verdict)
+			}
+
+			// Both attempts are billed
+			single := llm.CountTokens(step.Model, moderator.buildToxicityPrompt("you idiot"))
+			if step.Tokens == nil || step.Tokens.Prompt <= single {
+				t.Errorf("tokens %+v, want more than the %d of one attempt", step.Tokens, single)
+			}
+		})
+	}
+}
+
+func TestFitBudget(t *testing.T) {
+	long := strings.Repeat("this parcel was late again ", 40)
+	tests := []struct {
+		name      string
+		mode      string
+		comment   string
+		truncated bool
+		wantErr   bool
+	}{
+		{"within the budget", "reject", "the parcel arrived", false, false},
+		{"at the budget", "reject", strings.Repeat("word ", 9) + "word", false, false},
+		{"over, rejected", "reject", long, false, true},
+		{"over, truncated", "truncate", long, true, false},
+		{"multibyte, truncated", "truncate", strings.Repeat("配達が遅れました。", 40), true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INPUT_TOKEN_BUDGET", "10")
+			t.Setenv("INPUT_BUDGET_MODE", tt.mode)
+			moderator, _ := newTestModerator(t, nil)
+
+			comment, truncated, err := moderator.FitBudget(tt.comment)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInputTooLong) {
+					t.Fatalf("got %v, want ErrInputTooLong", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FitBudget: %v", err)
+			}
+			if truncated != tt.truncated {
+				t.Errorf("truncated = %v, want %v", truncated, tt.truncated)
+			}
+			if n := moderator.llmClient.CountTokens(llm.RoleModerator, comment); n > 10 {
+				t.Errorf("%d tokens left, want at most 10", n)
+			}
+			if !utf8.ValidString(comment) || !strings.HasPrefix(tt.comment, comment) {
+				t.Errorf("%q is not a clean prefix of the comment", comment)
+			}
+		})
+	}
+}
+
+func TestCheckToxicityBillsEmbedding(t *testing.T) {
+	t.Setenv("SEMANTIC_CACHE_ENABLED", "true")
+	t.Setenv("EMBEDDING_PROVIDER", "fake")
+	plain, cfg := newTestModerator(t, nil)
+	results := cache.NewResults(cache.NewMemory(100), time.Hour)
+	semantic := cache.NewSemantic(cfg.SemanticCacheThreshold, 100, time.Hour)
+	moderator := NewModeratorService(plain.llmClient, cfg, results, semantic, plain.logger)
+	ctx := context.Background()
+
+	_, step, err := moderator.CheckToxicity(ctx, "the parcel arrived")
+	if err != nil {
+		t.Fatalf("CheckToxicity: %v", err)
+	}
+	embedding := step.Embedding
+	if embedding == nil || embedding.Model != cfg.Embedding.Model || embedding.Tokens == nil || embedding.Tokens.Prompt == 0 {
+		t.Fatalf("embedding %+v, want the tokens of the lookup", embedding)
+	}
+
+	// The second lookup embeds nothing
+	_, step, err = moderator.CheckToxicity(ctx, "the parcel arrived")
+	if err != nil {
+		t.Fatalf("CheckToxicity: %v", err)
+	}
+	if !step.Cached || step.Embedding != nil {
+		t.Errorf("repeat lookup: cached %v, embedding %+v", step.Cached, step.Embedding)
+	}
+}
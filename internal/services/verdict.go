@@ -0,0 +1,150 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+// categories scoring at least this much are listed in the verdict
+const categoryThreshold = 0.5
+
+const verdictSchema = `{
+  "verdict": "toxic" | "clean",
+  "scores": {%s},
+  "confidence": number between 0 and 1,
+  "reason": "one short sentence"
+}
+Each score is between 0 and 1. threat covers threats and wishes of violence or death.`
+
+// renders the scores object of the schema with every category
+func verdictScoresSchema() string {
+	fields := make([]string, len(models.ToxicityCategories))
+	for i, category := range models.ToxicityCategories {
+		fields[i] = fmt.Sprintf("%q: number", category)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// errMalformedVerdict marks model output that could not be parsed or validated
+var errMalformedVerdict = errors.New("malformed toxicity verdict")
+
+// parseVerdict strictly decodes and validates a verdict. When the strict decode
+// fails it retries on the outermost JSON object, stripping code fences and prose.
+func parseVerdict(response string) (*models.ToxicityVerdict, error) {
+	verdict, err := decodeVerdict(response)
+	if err == nil {
+		return verdict, nil
+	}
+
+	if extracted, ok := extractJSONObject(response); ok && extracted != strings.TrimSpace(response) {
+		if repaired, repairErr := decodeVerdict(extracted); repairErr == nil {
+			return repaired, nil
+		}
+	}
+	return nil, err
+}
+
+func decodeVerdict(response string) (*models.ToxicityVerdict, error) {
+	decoder := json.NewDecoder(strings.NewReader(strings.TrimSpace(response)))
+	decoder.DisallowUnknownFields()
+
+	var verdict models.ToxicityVerdict
+	if err := decoder.Decode(&verdict); err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedVerdict, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: trailing data after JSON object", errMalformedVerdict)
+	}
+	if err := validateVerdict(&verdict); err != nil {
+		return nil, err
+	}
+	return &verdict, nil
+}
+
+func validateVerdict(verdict *models.ToxicityVerdict) error {
+	verdict.Verdict = strings.ToLower(strings.TrimSpace(verdict.Verdict))
+	if verdict.Verdict != models.VerdictToxic && verdict.Verdict != models.VerdictClean {
+		return fmt.Errorf("%w: verdict must be %q or %q, got %q", errMalformedVerdict, models.VerdictToxic, models.VerdictClean, verdict.Verdict)
+	}
+	if verdict.Confidence < 0 || verdict.Confidence > 1 {
+		return fmt.Errorf("%w: confidence %v outside [0, 1]", errMalformedVerdict, verdict.Confidence)
+	}
+
+	// Missing categories score 0; unknown ones or out of range scores are rejected
+	scores := make(map[string]float64, len(models.ToxicityCategories))
+	for _, category := range models.ToxicityCategories {
+		scores[category] = 0
+	}
+	for category, score := range verdict.Scores {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if !models.IsToxicityCategory(category) {
+			return fmt.Errorf("%w: unknown category %q", errMalformedVerdict, category)
+		}
+		if score < 0 || score > 1 {
+			return fmt.Errorf("%w: %s score %v outside [0, 1]", errMalformedVerdict, category, score)
+		}
+		scores[category] = score
+	}
+	verdict.Scores = scores
+
+	// Categories are derived from the scores, highest first
+	categories := []string{}
+	for _, category := range models.ToxicityCategories {
+		if scores[category] >= categoryThreshold {
+			categories = append(categories, category)
+		}
+	}
+	sort.SliceStable(categories, func(i, j int) bool {
+		return scores[categories[i]] > scores[categories[j]]
+	})
+	verdict.Categories = categories
+
+	verdict.Reason = strings.TrimSpace(verdict.Reason)
+	return nil
+}
+
+// returns the span from the first '{' to its matching '}'
+func extractJSONObject(response string) (string, bool) {
+	start := strings.IndexByte(response, '{')
+	if start < 0 {
+		return "", false
+	}
+
+	depth := 0
+	inString := false
+	escaped := false
+	for i := start; i < len(response); i++ {
+		ch := response[i]
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\' && inString:
+			escaped = true
+		case ch == '"':
+			inString = !inString
+		case ch == '{' && !inString:
+			depth++
+		case ch == '}' && !inString:
+			depth--
+			if depth == 0 {
+				return response[start : i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// compacts model output for inclusion in a repair prompt
+func compactOutput(response string) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(response)); err == nil {
+		return buf.String()
+	}
+	return strings.TrimSpace(response)
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+func TestParseVerdict(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		verdict    string
+		categories []string
+		wantErr    bool
+	}{
+		{"plain JSON", `{"verdict": "toxic", "scores": {"harassment": 0.8}, "confidence": 0.9, "reason": "insult"}`, models.VerdictToxic, []string{"harassment"}, false},
+		{"fenced JSON", "```json\n{\"verdict\": \"clean\", \"scores\": {}, \"confidence\": 0.9, \"reason\": \"fine\"}\n```", models.VerdictClean, []string{}, false},
+		{"leading and trailing prose", `Here is my answer: {"verdict": "toxic", "scores": {"threat": 0.95}, "confidence": 1, "reason": "a {braced} threat"} Hope this helps.`, models.VerdictToxic, []string{"threat"}, false},
+		{"categories by score", `{"verdict": "toxic", "scores": {"profanity": 0.6, "harassment": 0.9, "spam": 0.2}, "confidence": 0.9, "reason": ""}`, models.VerdictToxic, []string{"harassment", "profanity"}, false},
+		{"verdict case and space", `{"verdict": " Toxic ", "scores": {"Harassment": 0.7}, "confidence": 0.5, "reason": "x"}`, models.VerdictToxic, []string{"harassment"}, false},
+		{"not JSON", `The comment is toxic.`, "", nil, true},
+		{"unknown verdict", `{"verdict": "maybe", "scores": {}, "confidence": 0.5, "reason": ""}`, "", nil, true},
+		{"score as a string", `{"verdict": "toxic", "scores": {"harassment": "high"}, "confidence": 0.9, "reason": ""}`, "", nil, true},
+		{"confidence as a string", `{"verdict": "clean", "scores": {}, "confidence": "sure", "reason": ""}`, "", nil, true},
+		{"score above 1", `{"verdict": "toxic", "scores": {"harassment": 8}, "confidence": 0.9, "reason": ""}`, "", nil, true},
+		{"negative score", `{"verdict": "toxic", "scores": {"harassment": -0.1}, "confidence": 0.9, "reason": ""}`, "", nil, true},
+		{"confidence above 1", `{"verdict": "clean", "scores": {}, "confidence": 90, "reason": ""}`, "", nil, true},
+		{"unknown category", `{"verdict": "toxic", "scores": {"rudeness": 0.9}, "confidence": 0.9, "reason": ""}`, "", nil, true},
+		{"unknown field", `{"verdict": "clean", "scores": {}, "confidence": 0.9, "reason": "", "notes": "x"}`, "", nil, true},
+		{"two objects", `{"verdict": "clean", "scores": {}, "confidence": 0.9, "reason": ""} {"verdict": "toxic"}`, models.VerdictClean, []string{}, false},
+		{"unterminated object", `{"verdict": "clean", "scores": {`, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := parseVerdict(tt.response)
+			if tt.wantErr {
+				if !errors.Is(err, errMalformedVerdict) {
+					t.Fatalf("got %+v, %v, want a malformed verdict error", verdict, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseVerdict: %v", err)
+			}
+			if verdict.Verdict != tt.verdict || !reflect.DeepEqual(verdict.Categories, tt.categories) {
+				t.Errorf("got %s %v, want %s %v", verdict.Verdict, verdict.Categories, tt.verdict, tt.categories)
+			}
+			// Every category is scored, missing ones as 0
+			if len(verdict.Scores) != len(models.ToxicityCategories) {
+				t.Errorf("scores %v, want every category", verdict.Scores)
+			}
+		})
+	}
+}
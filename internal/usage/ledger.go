@@ -0,0 +1,202 @@
+package usage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+const (
+	// Anonymous stands in for requests without a user id or API key
+	Anonymous = "anonymous"
+	// Unlisted labels metrics of API keys missing from the tenant list, so
+	// made-up keys can't mint new series
+	Unlisted = "unknown"
+	// Other collects the users and tenants seen once the ledger is full
+	Other = "other"
+)
+
+var (
+	costTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_cost_dollars_total",
+		Help: "Estimated LLM spend in US dollars by tenant and model",
+	}, []string{"tenant", "model"})
+
+	tenantTokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_tenant_tokens_total",
+		Help: "Tokens spent by tenant and kind (prompt, completion)",
+	}, []string{"tenant", "kind"})
+
+	unpricedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_unpriced_calls_total",
+		Help: "Steps served by a model missing from the pricing table",
+	}, []string{"model"})
+)
+
+// Totals aggregates what a user or tenant has spent
+type Totals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+func (t *Totals) add(tokens models.TokenUsage, cost float64) {
+	t.Requests++
+	t.PromptTokens += tokens.Prompt
+	t.CompletionTokens += tokens.Completion
+	t.CostUSD += cost
+}
+
+// Report is a snapshot of one tenant's spend
+type Report struct {
+	Since  time.Time         `json:"since"`
+	Tenant string            `json:"tenant"`
+	Total  Totals            `json:"total"`
+	Users  map[string]Totals `json:"users"`
+}
+
+// Ledger prices chain runs and keeps running totals per tenant, and per user
+// within a tenant, since the process started. It holds at most maxEntries
+// tenants and users; later ones are counted under Other.
+type Ledger struct {
+	pricing    *Pricing
+	known      map[string]bool
+	maxEntries int
+
+	mu      sync.Mutex
+	since   time.Time
+	entries int
+	tenants map[string]*account
+}
+
+// account is a tenant's totals and its users'
+type account struct {
+	Totals
+	users map[string]*Totals
+}
+
+// tenants are the configured tenant names, the only ones used as metric
+// labels. maxEntries of 0 means unbounded.
+func NewLedger(pricing *Pricing, tenants []string, maxEntries int) *Ledger {
+	known := make(map[string]bool, len(tenants))
+	for _, tenant := range tenants {
+		known[tenant] = true
+	}
+	return &Ledger{
+		pricing:    pricing,
+		known:      known,
+		maxEntries: maxEntries,
+		since:      time.Now(),
+		tenants:    make(map[string]*account),
+	}
+}
+
+// Charge prices every step of a response in place, records the run against
+// the user and tenant, and returns its total cost
+func (l *Ledger) Charge(userID, tenant string, response *models.ModeratedResponse) float64 {
+	if userID == "" {
+		userID = Anonymous
+	}
+	if tenant == "" {
+		tenant = Anonymous
+	}
+	label := tenant
+	if tenant != Anonymous && !l.known[tenant] {
+		label = Unlisted
+	}
+
+	var cost float64
+	for name, step := range response.Steps {
+		cost += l.price(label, &step)
+		if step.Embedding != nil {
+			embedding := *step.Embedding
+			cost += l.price(label, &embedding)
+			step.Embedding = &embedding
+		}
+		response.Steps[name] = step
+	}
+	response.CostUSD = cost
+
+	tenantTokensTotal.WithLabelValues(label, "prompt").Add(float64(response.Tokens.Prompt))
+	tenantTokensTotal.WithLabelValues(label, "completion").Add(float64(response.Tokens.Completion))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	acct := l.account(tenant)
+	acct.add(response.Tokens, cost)
+	l.user(acct, userID).add(response.Tokens, cost)
+	return cost
+}
+
+// sets the cost of what a step spent and returns it
+func (l *Ledger) price(label string, step *models.StepInfo) float64 {
+	if step.Tokens == nil {
+		return 0
+	}
+	cost, ok := l.pricing.Cost(step.Model, step.Tokens.Prompt, step.Tokens.Completion)
+	if !ok {
+		unpricedTotal.WithLabelValues(step.Model).Inc()
+	}
+	step.CostUSD = cost
+	costTotal.WithLabelValues(label, step.Model).Add(cost)
+	return cost
+}
+
+// Report copies a tenant's current totals
+func (l *Ledger) Report(tenant string) Report {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	report := Report{Since: l.since, Tenant: tenant, Users: map[string]Totals{}}
+	acct, ok := l.tenants[tenant]
+	if !ok {
+		return report
+	}
+	report.Total = acct.Totals
+	for id, t := range acct.users {
+		report.Users[id] = *t
+	}
+	return report
+}
+
+func (l *Ledger) full() bool {
+	return l.maxEntries > 0 && l.entries >= l.maxEntries
+}
+
+func (l *Ledger) account(tenant string) *account {
+	if acct, ok := l.tenants[tenant]; ok {
+		return acct
+	}
+	if l.full() {
+		tenant = Other
+		if acct, ok := l.tenants[tenant]; ok {
+			return acct
+		}
+	}
+	acct := &account{users: make(map[string]*Totals)}
+	l.tenants[tenant] = acct
+	l.entries++
+	return acct
+}
+
+func (l *Ledger) user(acct *account, userID string) *Totals {
+	if t, ok := acct.users[userID]; ok {
+		return t
+	}
+	if l.full() {
+		userID = Other
+		if t, ok := acct.users[userID]; ok {
+			return t
+		}
+	}
+	t := &Totals{}
+	acct.users[userID] = t
+	l.entries++
+	return t
+}
@@ -0,0 +1,122 @@
+package usage
+
+import (
+	"math"
+	"testing"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+func run(steps map[string]models.StepInfo) *models.ModeratedResponse {
+	response := &models.ModeratedResponse{Steps: steps}
+	for _, step := range steps {
+		if step.Tokens != nil {
+			response.Tokens = response.Tokens.Add(*step.Tokens)
+		}
+		if step.Embedding != nil {
+			response.Tokens = response.Tokens.Add(*step.Embedding.Tokens)
+		}
+	}
+	return response
+}
+
+func tokens(prompt, completion int) *models.TokenUsage {
+	return &models.TokenUsage{Prompt: prompt, Completion: completion, Total: prompt + completion}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-12
+}
+
+func TestChargePricesEverySpend(t *testing.T) {
+	ledger := NewLedger(Default(), []string{"acme"}, 0)
+	response := run(map[string]models.StepInfo{
+		models.StepToxicity: {
+			Model:     "gpt-4o-mini",
+			Tokens:    tokens(1000, 100),
+			Embedding: &models.StepInfo{Model: "text-embedding-3-small", Tokens: tokens(50, 0)},
+		},
+		models.StepModeration: {Model: "gpt-4o-mini", Cached: true},
+		models.StepReply:      {Model: "some-local-model", Tokens: tokens(400, 200)},
+		models.StepPrefilter:  {Model: models.StepPrefilter, Rule: "insults"},
+	})
+
+	cost := ledger.Charge("u1", "acme", response)
+
+	toxicity := response.Steps[models.StepToxicity]
+	if want := (1000*0.15 + 100*0.6) / 1e6; !near(toxicity.CostUSD, want) {
+		t.Errorf("toxicity cost %v, want %v", toxicity.CostUSD, want)
+	}
+	if want := 50 * 0.02 / 1e6; !near(toxicity.Embedding.CostUSD, want) {
+		t.Errorf("embedding cost %v, want %v", toxicity.Embedding.CostUSD, want)
+	}
+	// Unpriced models and cache hits cost nothing
+	if c := response.Steps[models.StepReply].CostUSD + response.Steps[models.StepModeration].CostUSD; c != 0 {
+		t.Errorf("unpriced and cached steps cost %v", c)
+	}
+	if want := toxicity.CostUSD + toxicity.Embedding.CostUSD; !near(cost, want) || !near(response.CostUSD, want) {
+		t.Errorf("total %v (response %v), want %v", cost, response.CostUSD, want)
+	}
+
+	report := ledger.Report("acme")
+	if report.Total.Requests != 1 || report.Total.PromptTokens != 1450 || report.Total.CompletionTokens != 300 || !near(report.Total.CostUSD, cost) {
+		t.Errorf("tenant totals %+v", report.Total)
+	}
+	if report.Users["u1"] != report.Total {
+		t.Errorf("user totals %+v, want %+v", report.Users["u1"], report.Total)
+	}
+}
+
+func TestReportIsPerTenant(t *testing.T) {
+	ledger := NewLedger(Default(), []string{"acme", "globex"}, 0)
+	spend := func() *models.ModeratedResponse {
+		return run(map[string]models.StepInfo{models.StepReply: {Model: "gpt-4o", Tokens: tokens(100, 10)}})
+	}
+	ledger.Charge("u1", "acme", spend())
+	ledger.Charge("u1", "acme", spend())
+	ledger.Charge("u2", "globex", spend())
+	ledger.Charge("", "", spend())
+
+	tests := []struct {
+		tenant   string
+		requests int
+		users    []string
+	}{
+		{"acme", 2, []string{"u1"}},
+		{"globex", 1, []string{"u2"}},
+		{Anonymous, 1, []string{Anonymous}},
+		{"initech", 0, nil},
+	}
+	for _, tt := range tests {
+		report := ledger.Report(tt.tenant)
+		if report.Tenant != tt.tenant || report.Total.Requests != tt.requests || len(report.Users) != len(tt.users) {
+			t.Errorf("%s: %+v", tt.tenant, report)
+		}
+		for _, user := range tt.users {
+			if report.Users[user].Requests != tt.requests {
+				t.Errorf("%s: user %s has %+v", tt.tenant, user, report.Users[user])
+			}
+		}
+	}
+}
+
+func TestLedgerCountsOverflowAsOther(t *testing.T) {
+	// Room for one tenant and one of its users
+	ledger := NewLedger(Default(), nil, 2)
+	spend := func() *models.ModeratedResponse {
+		return run(map[string]models.StepInfo{models.StepReply: {Model: "gpt-4o", Tokens: tokens(10, 1)}})
+	}
+	ledger.Charge("u1", "acme", spend())
+	ledger.Charge("u2", "acme", spend())
+	ledger.Charge("u3", "globex", spend())
+
+	if report := ledger.Report("acme"); report.Total.Requests != 2 || report.Users[Other].Requests != 1 {
+		t.Errorf("acme: %+v", report)
+	}
+	if report := ledger.Report("globex"); report.Total.Requests != 0 {
+		t.Errorf("a tenant past the limit got its own entry: %+v", report)
+	}
+	if report := ledger.Report(Other); report.Total.Requests != 1 {
+		t.Errorf("other: %+v", report)
+	}
+}
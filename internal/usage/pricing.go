@@ -0,0 +1,70 @@
+package usage
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Price of a model in US dollars per million tokens
+type Price struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// Pricing maps model names to their price
+type Pricing struct {
+	Models map[string]Price `yaml:"models"`
+}
+
+// Default carries list prices for the models the service is usually run with
+func Default() *Pricing {
+	return &Pricing{Models: map[string]Price{
+		"gpt-4":                    {Input: 30, Output: 60},
+		"gpt-4-turbo":              {Input: 10, Output: 30},
+		"gpt-4o":                   {Input: 2.5, Output: 10},
+		"gpt-4o-mini":              {Input: 0.15, Output: 0.6},
+		"gpt-3.5-turbo":            {Input: 0.5, Output: 1.5},
+		"claude-3-5-haiku-latest":  {Input: 0.8, Output: 4},
+		"claude-3-5-sonnet-latest": {Input: 3, Output: 15},
+		"text-embedding-3-small":   {Input: 0.02},
+		"text-embedding-3-large":   {Input: 0.13},
+	}}
+}
+
+// Load reads a pricing table from a YAML file on top of the defaults. An empty
+// path returns the defaults.
+func Load(path string) (*Pricing, error) {
+	p := Default()
+	if path == "" {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var file Pricing
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing file: %w", err)
+	}
+	for model, price := range file.Models {
+		if price.Input < 0 || price.Output < 0 {
+			return nil, fmt.Errorf("invalid pricing %s: negative price for %s", path, model)
+		}
+		p.Models[model] = price
+	}
+
+	return p, nil
+}
+
+// Cost of a call in dollars; ok is false for models without a price
+func (p *Pricing) Cost(model string, promptTokens, completionTokens int) (float64, bool) {
+	price, ok := p.Models[model]
+	if !ok {
+		return 0, false
+	}
+	return (float64(promptTokens)*price.Input + float64(completionTokens)*price.Output) / 1e6, true
+}
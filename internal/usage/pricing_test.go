@@ -0,0 +1,78 @@
+package usage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPricingCost(t *testing.T) {
+	p := Default()
+	tests := []struct {
+		model      string
+		prompt     int
+		completion int
+		cost       float64
+		ok         bool
+	}{
+		{"gpt-4o-mini", 1_000_000, 0, 0.15, true},
+		{"gpt-4o-mini", 2000, 1000, 0.0009, true},
+		{"text-embedding-3-small", 500_000, 0, 0.01, true},
+		{"gpt-4o", 0, 0, 0, true},
+		{"some-local-model", 1000, 1000, 0, false},
+	}
+	for _, tt := range tests {
+		cost, ok := p.Cost(tt.model, tt.prompt, tt.completion)
+		if ok != tt.ok || math.Abs(cost-tt.cost) > 1e-12 {
+			t.Errorf("Cost(%s, %d, %d) = %v %v, want %v %v", tt.model, tt.prompt, tt.completion, cost, ok, tt.cost, tt.ok)
+		}
+	}
+}
+
+func TestLoadPricing(t *testing.T) {
+	p, err := Load("")
+	if err != nil || len(p.Models) != len(Default().Models) {
+		t.Fatalf("empty path: %d models, %v", len(p.Models), err)
+	}
+
+	p, err = Load("../../configs/pricing.yaml")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if _, ok := p.Models["gpt-4o-mini"]; !ok {
+		t.Error("the file dropped the default prices")
+	}
+
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"negative price", "models:\n  gpt-4o:\n    input: -1", "negative price for gpt-4o"},
+		{"not yaml", "models: [", "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pricing.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// A file overrides and extends the defaults
+	path := filepath.Join(t.TempDir(), "pricing.yaml")
+	os.WriteFile(path, []byte("models:\n  gpt-4o:\n    input: 1\n    output: 2\n  llama3:\n    input: 0.1\n"), 0o644)
+	p, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if p.Models["gpt-4o"] != (Price{Input: 1, Output: 2}) || p.Models["llama3"].Input != 0.1 || p.Models["gpt-4"].Input != 30 {
+		t.Errorf("unexpected prices %+v", p.Models)
+	}
+}
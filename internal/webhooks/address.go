@@ -0,0 +1,67 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+)
+
+// ErrForbiddenAddress is reported for a webhook URL that points at the
+// server's own network: loopback, private, link-local or unspecified addresses
+// such as 127.0.0.1, 10.0.0.0/8 or the cloud metadata service at 169.254.169.254.
+var ErrForbiddenAddress = errors.New("webhook URL must not point at a private or local address")
+
+// forbidden reports whether ip is somewhere a webhook mustn't reach
+func forbidden(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast()
+}
+
+// CheckURL vets a webhook URL at registration: it must be http or https and
+// its host must resolve only to public addresses. Deliveries are checked again
+// when they connect, since what a name resolves to can change.
+func (d *Dispatcher) CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an http or https URL")
+	}
+	if d.allowPrivate {
+		return nil
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if forbidden(ip) {
+			return ErrForbiddenAddress
+		}
+		return nil
+	}
+	addrs, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("url host %q could not be resolved", host)
+	}
+	for _, addr := range addrs {
+		if forbidden(addr.IP) {
+			return ErrForbiddenAddress
+		}
+	}
+	return nil
+}
+
+// checkDial is a net.Dialer Control hook refusing connections to forbidden
+// addresses, whatever the URL's host resolved to by then
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || forbidden(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
@@ -0,0 +1,437 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+
+	"github.com/harshaSenaratne/reword/internal/config"
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Reword-Event"
+	HeaderDelivery  = "X-Reword-Delivery"
+	HeaderSignature = "X-Reword-Signature"
+)
+
+const (
+	// maxBackoff caps the wait between attempts
+	maxBackoff = time.Hour
+	// purgeInterval between sweeps of deliveries past their retention
+	purgeInterval = time.Hour
+	// retryInterval before scanning again after a storage error
+	retryInterval = 5 * time.Second
+)
+
+var (
+	deliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_webhook_deliveries_total",
+		Help: "Webhook delivery attempts by event and outcome (delivered, retrying, failed)",
+	}, []string{"event", "outcome"})
+	eventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_webhook_events_dropped_total",
+		Help: "Webhook events dropped because the queue was full, by event",
+	}, []string{"event"})
+)
+
+// Dispatcher turns moderation outcomes into signed webhook deliveries and
+// sends them, retrying failures with exponential backoff. Events wait in a
+// bounded queue until Run stores their deliveries; once stored, deliveries
+// are not lost across a restart.
+type Dispatcher struct {
+	store        *Store
+	client       *http.Client
+	resolver     *net.Resolver
+	allowPrivate bool
+	events       chan queuedEvent
+	workers      int
+	maxAttempts  int
+	backoff      time.Duration
+	retention    time.Duration
+	wake         chan struct{}
+	logger       *logrus.Logger
+}
+
+// queuedEvent is an event waiting for its deliveries to be stored
+type queuedEvent struct {
+	tenant  string
+	event   string
+	payload []byte
+	at      time.Time
+}
+
+func NewDispatcher(store *Store, cfg *config.Config, logger *logrus.Logger) *Dispatcher {
+	workers := cfg.WebhookWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	maxAttempts := cfg.WebhookMaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	backoff := cfg.WebhookBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	queueSize := cfg.WebhookQueueSize
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.WebhookAllowPrivate {
+		// Every connection is checked where it lands, so neither DNS changes
+		// after registration nor a proxy can route a delivery inward
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkDial}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+	return &Dispatcher{
+		store:        store,
+		resolver:     net.DefaultResolver,
+		allowPrivate: cfg.WebhookAllowPrivate,
+		events:       make(chan queuedEvent, queueSize),
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.WebhookTimeout,
+			// A redirect is an answer we didn't ask for, not a delivery
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		retention:   cfg.WebhookRetention,
+		wake:        make(chan struct{}, 1),
+		logger:      logger,
+	}
+}
+
+// Notify queues event for every webhook of tenant subscribed to it, without
+// waiting on storage: it is called on the request path. When the queue is
+// full the event is dropped. Requests without a tenant have nobody to notify.
+func (d *Dispatcher) Notify(tenant, event string, data any) {
+	if tenant == "" {
+		return
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(models.WebhookEvent{
+		ID:        newID(),
+		Type:      event,
+		CreatedAt: now,
+		Data:      data,
+	})
+	if err != nil {
+		d.logger.WithError(err).Error("Failed to encode webhook event")
+		return
+	}
+
+	select {
+	case d.events <- queuedEvent{tenant: tenant, event: event, payload: payload, at: now}:
+	default:
+		eventsDropped.WithLabelValues(event).Inc()
+		d.logger.WithFields(logrus.Fields{
+			"tenant": tenant,
+			"event":  event,
+		}).Warn("Webhook queue full, event dropped")
+	}
+}
+
+// stores a delivery of a queued event for each subscribed webhook
+func (d *Dispatcher) enqueue(e queuedEvent) {
+	hooks, err := d.store.Subscribers(e.tenant, e.event)
+	if err != nil {
+		d.logger.WithError(err).Error("Failed to look up webhooks")
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	for _, hook := range hooks {
+		delivery := &models.WebhookDelivery{
+			ID:        newID(),
+			WebhookID: hook.ID,
+			Event:     e.event,
+			Status:    models.DeliveryPending,
+			Payload:   e.payload,
+			CreatedAt: e.at,
+		}
+		if err := d.store.AddDelivery(delivery); err != nil {
+			d.logger.WithError(err).WithField("webhook_id", hook.ID).Error("Failed to queue webhook delivery")
+		}
+	}
+	d.poke()
+}
+
+// stores queued events as they come in. On shutdown the events already
+// queued are still stored, to be sent after the restart.
+func (d *Dispatcher) drain(ctx context.Context) {
+	for {
+		select {
+		case e := <-d.events:
+			d.enqueue(e)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-d.events:
+					d.enqueue(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Replay queues a new delivery of an earlier one's payload. The event keeps
+// its ID so receivers can tell a replay from a new event.
+func (d *Dispatcher) Replay(tenant, webhookID, deliveryID string) (*models.WebhookDelivery, error) {
+	original, err := d.store.Delivery(tenant, webhookID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &models.WebhookDelivery{
+		ID:        newID(),
+		WebhookID: original.WebhookID,
+		Event:     original.Event,
+		Status:    models.DeliveryPending,
+		ReplayOf:  original.ID,
+		Payload:   original.Payload,
+		CreatedAt: time.Now(),
+	}
+	if err := d.store.AddDelivery(delivery); err != nil {
+		return nil, err
+	}
+	d.poke()
+	return delivery, nil
+}
+
+func (d *Dispatcher) poke() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run stores queued events and sends due deliveries until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		d.drain(ctx)
+	}()
+	defer func() { <-drained }()
+
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+	d.purge()
+
+	for ctx.Err() == nil {
+		due, next, err := d.store.Due(time.Now())
+		if err != nil {
+			d.logger.WithError(err).Error("Failed to list due webhook deliveries")
+			next = time.Now().Add(retryInterval)
+		}
+		if len(due) > 0 {
+			if !d.sendAll(ctx, due) {
+				// Don't spin on deliveries whose outcome can't be stored
+				select {
+				case <-ctx.Done():
+				case <-time.After(retryInterval):
+				}
+			}
+			continue
+		}
+
+		var timer *time.Timer
+		var wait <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			wait = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-d.wake:
+		case <-wait:
+		case <-purge.C:
+			d.purge()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// attempts every due delivery, reporting whether all outcomes were stored
+func (d *Dispatcher) sendAll(ctx context.Context, due []*models.WebhookDelivery) bool {
+	slots := make(chan struct{}, d.workers)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(delivery *models.WebhookDelivery) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := d.attempt(ctx, delivery); err != nil {
+				failed.Store(true)
+			}
+		}(delivery)
+	}
+	wg.Wait()
+	return !failed.Load()
+}
+
+// makes one attempt and records its outcome. An attempt cut short by shutdown
+// isn't counted and is made again after the restart.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	logger := d.logger.WithFields(logrus.Fields{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.WebhookID,
+		"event":       delivery.Event,
+	})
+
+	hook, err := d.store.lookup(delivery.WebhookID)
+	if errors.Is(err, ErrNotFound) {
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = "webhook was deleted"
+		delivery.NextAttemptAt = nil
+		return d.record(logger, delivery)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to load webhook")
+		return err
+	}
+
+	code, err := d.send(ctx, hook, delivery)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+		deliveriesTotal.WithLabelValues(delivery.Event, "delivered").Inc()
+		return d.record(logger, delivery)
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Status = models.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		deliveriesTotal.WithLabelValues(delivery.Event, "failed").Inc()
+		logger.WithError(err).Warn("Webhook delivery failed, giving up")
+	} else {
+		next := now.Add(d.delay(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		deliveriesTotal.WithLabelValues(delivery.Event, "retrying").Inc()
+		logger.WithError(err).WithField("attempts", delivery.Attempts).Info("Webhook delivery failed, will retry")
+	}
+	return d.record(logger, delivery)
+}
+
+func (d *Dispatcher) send(ctx context.Context, hook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "reword-webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff doubles with every failed attempt, up to maxBackoff
+func (d *Dispatcher) delay(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) record(logger *logrus.Entry, delivery *models.WebhookDelivery) error {
+	err := d.store.UpdateDelivery(delivery)
+	if err != nil {
+		logger.WithError(err).Error("Failed to record webhook delivery")
+	}
+	return err
+}
+
+func (d *Dispatcher) purge() {
+	if d.retention <= 0 {
+		return
+	}
+	purged, err := d.store.Purge(time.Now().Add(-d.retention))
+	if err != nil {
+		d.logger.WithError(err).Warn("Failed to purge old webhook deliveries")
+		return
+	}
+	if purged > 0 {
+		d.logger.WithField("purged", purged).Info("Purged expired webhook deliveries")
+	}
+}
+
+// Sign returns the signature header for a payload sent at t:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<payload>">".
+// Receivers recompute it with the webhook's secret and should reject stale
+// timestamps to stop replayed requests.
+func Sign(secret string, t time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
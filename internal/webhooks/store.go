@@ -0,0 +1,355 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/harshaSenaratne/reword/internal/models"
+)
+
+// ErrNotFound is returned for unknown webhooks and deliveries, including those
+// of another tenant
+var ErrNotFound = errors.New("webhook not found")
+
+var (
+	webhooksBucket   = []byte("webhooks")
+	deliveriesBucket = []byte("deliveries")
+	// pendingBucket indexes the deliveries still to be attempted
+	pendingBucket = []byte("pending")
+)
+
+// Store persists webhooks and their delivery log in a bbolt file
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens (or creates) the webhook file at path
+func OpenStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create webhook directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open webhook file: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{webhooksBucket, deliveriesBucket, pendingBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize webhook file: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create registers a webhook with a fresh signing secret
+func (s *Store) Create(tenant string, req models.WebhookRequest) (*models.Webhook, error) {
+	events := req.Events
+	if len(events) == 0 {
+		events = models.WebhookEvents
+	}
+	hook := &models.Webhook{
+		ID:        newID(),
+		URL:       req.URL,
+		Events:    events,
+		Secret:    newSecret(),
+		Tenant:    tenant,
+		CreatedAt: time.Now(),
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, webhooksBucket, hook.ID, record(*hook))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store webhook: %w", err)
+	}
+	return hook, nil
+}
+
+// record is a webhook as stored, with the tenant and secret the API keeps to itself
+type record struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret"`
+	Tenant    string    `json:"tenant"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func decodeWebhook(data []byte) (*models.Webhook, error) {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return &models.Webhook{
+		ID:        r.ID,
+		URL:       r.URL,
+		Events:    r.Events,
+		Secret:    r.Secret,
+		Tenant:    r.Tenant,
+		CreatedAt: r.CreatedAt,
+	}, nil
+}
+
+// Get returns a tenant's webhook, secret included
+func (s *Store) Get(tenant, id string) (*models.Webhook, error) {
+	var hook *models.Webhook
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		hook, err = getWebhook(tx, tenant, id)
+		return err
+	})
+	return hook, err
+}
+
+// lookup returns a webhook whatever its tenant, for delivery
+func (s *Store) lookup(id string) (*models.Webhook, error) {
+	var hook *models.Webhook
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(webhooksBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		var err error
+		hook, err = decodeWebhook(data)
+		return err
+	})
+	return hook, err
+}
+
+// List returns a tenant's webhooks, oldest first
+func (s *Store) List(tenant string) ([]*models.Webhook, error) {
+	hooks := []*models.Webhook{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(webhooksBucket).ForEach(func(k, v []byte) error {
+			hook, err := decodeWebhook(v)
+			if err != nil {
+				return err
+			}
+			if hook.Tenant == tenant {
+				hooks = append(hooks, hook)
+			}
+			return nil
+		})
+	})
+	return hooks, err
+}
+
+// Subscribers returns the tenant's webhooks that want event
+func (s *Store) Subscribers(tenant, event string) ([]*models.Webhook, error) {
+	hooks, err := s.List(tenant)
+	if err != nil {
+		return nil, err
+	}
+	subscribed := hooks[:0]
+	for _, hook := range hooks {
+		for _, e := range hook.Events {
+			if e == event {
+				subscribed = append(subscribed, hook)
+				break
+			}
+		}
+	}
+	return subscribed, nil
+}
+
+// Delete removes a webhook. Its delivery log stays until purged, but nothing
+// more is sent to it.
+func (s *Store) Delete(tenant, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if _, err := getWebhook(tx, tenant, id); err != nil {
+			return err
+		}
+		return tx.Bucket(webhooksBucket).Delete([]byte(id))
+	})
+}
+
+// AddDelivery queues a delivery for its first attempt
+func (s *Store) AddDelivery(delivery *models.WebhookDelivery) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := put(tx, deliveriesBucket, delivery.ID, delivery); err != nil {
+			return err
+		}
+		return tx.Bucket(pendingBucket).Put([]byte(delivery.ID), nil)
+	})
+}
+
+// UpdateDelivery records an attempt, dropping the delivery from the pending
+// index once it is no longer pending
+func (s *Store) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := put(tx, deliveriesBucket, delivery.ID, delivery); err != nil {
+			return err
+		}
+		if delivery.Status != models.DeliveryPending {
+			return tx.Bucket(pendingBucket).Delete([]byte(delivery.ID))
+		}
+		return nil
+	})
+}
+
+// Delivery returns one delivery of a tenant's webhook
+func (s *Store) Delivery(tenant, webhookID, id string) (*models.WebhookDelivery, error) {
+	var delivery *models.WebhookDelivery
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if _, err := getWebhook(tx, tenant, webhookID); err != nil {
+			return err
+		}
+		var err error
+		delivery, err = getDelivery(tx, id)
+		if err == nil && delivery.WebhookID != webhookID {
+			err = ErrNotFound
+		}
+		return err
+	})
+	return delivery, err
+}
+
+// Deliveries returns up to limit of a webhook's deliveries, newest first
+func (s *Store) Deliveries(tenant, webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	deliveries := []*models.WebhookDelivery{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if _, err := getWebhook(tx, tenant, webhookID); err != nil {
+			return err
+		}
+		cursor := tx.Bucket(deliveriesBucket).Cursor()
+		for k, v := cursor.Last(); k != nil && len(deliveries) < limit; k, v = cursor.Prev() {
+			var delivery models.WebhookDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if delivery.WebhookID == webhookID {
+				deliveries = append(deliveries, &delivery)
+			}
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+// Due returns pending deliveries whose next attempt is at or before now, oldest
+// first, and when the earliest of the rest is due (zero if there are none)
+func (s *Store) Due(now time.Time) ([]*models.WebhookDelivery, time.Time, error) {
+	var due []*models.WebhookDelivery
+	var next time.Time
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).ForEach(func(k, _ []byte) error {
+			delivery, err := getDelivery(tx, string(k))
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			at := delivery.CreatedAt
+			if delivery.NextAttemptAt != nil {
+				at = *delivery.NextAttemptAt
+			}
+			if !at.After(now) {
+				due = append(due, delivery)
+			} else if next.IsZero() || at.Before(next) {
+				next = at
+			}
+			return nil
+		})
+	})
+	return due, next, err
+}
+
+// Purge deletes finished deliveries created before cutoff
+func (s *Store) Purge(cutoff time.Time) (int, error) {
+	purged := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		deliveries := tx.Bucket(deliveriesBucket)
+		var expired [][]byte
+		err := deliveries.ForEach(func(k, v []byte) error {
+			var delivery models.WebhookDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if delivery.Status != models.DeliveryPending && delivery.CreatedAt.Before(cutoff) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			if err := deliveries.Delete(k); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func getWebhook(tx *bolt.Tx, tenant, id string) (*models.Webhook, error) {
+	data := tx.Bucket(webhooksBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	hook, err := decodeWebhook(data)
+	if err != nil {
+		return nil, err
+	}
+	if hook.Tenant != tenant {
+		return nil, ErrNotFound
+	}
+	return hook, nil
+}
+
+func getDelivery(tx *bolt.Tx, id string) (*models.WebhookDelivery, error) {
+	data := tx.Bucket(deliveriesBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var delivery models.WebhookDelivery
+	if err := json.Unmarshal(data, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func put(tx *bolt.Tx, bucket []byte, id string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put([]byte(id), data)
+}
+
+// IDs start with the creation time so bucket order is creation order
+func newID() string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%012x%s", time.Now().UnixMilli(), hex.EncodeToString(suffix))
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
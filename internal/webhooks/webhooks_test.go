@@ -0,0 +1,280 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/harshaSenaratne/reword/internal/config"
+	"github.com/harshaSenaratne/reword/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// verify checks a signature header the way a receiver would
+func verify(secret, header string, payload []byte, now time.Time, tolerance time.Duration) bool {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || now.Sub(time.Unix(unix, 0)).Abs() > tolerance {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + string(payload)))
+	want := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(want))
+}
+
+func TestSign(t *testing.T) {
+	sent := time.Unix(1700000000, 0)
+	payload := []byte(`{"type":"comment.rewritten"}`)
+	header := Sign("whsec_test", sent, payload)
+
+	if !strings.HasPrefix(header, "t=1700000000,v1=") {
+		t.Fatalf("header %q", header)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		payload []byte
+		now     time.Time
+		valid   bool
+	}{
+		{"valid", "whsec_test", payload, sent.Add(time.Minute), true},
+		{"wrong secret", "whsec_other", payload, sent, false},
+		{"tampered payload", "whsec_test", []byte(`{"type":"comment.blocked"}`), sent, false},
+		{"stale timestamp", "whsec_test", payload, sent.Add(time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verify(tt.secret, header, tt.payload, tt.now, 5*time.Minute); got != tt.valid {
+				t.Errorf("valid = %v, want %v", got, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	var failures []string
+	received := make(chan models.WebhookEvent, 1)
+
+	var hook *models.Webhook
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if !verify(hook.Secret, r.Header.Get(HeaderSignature), payload, time.Now(), time.Minute) {
+			failures = append(failures, "bad signature")
+		}
+		if r.Header.Get(HeaderEvent) != models.WebhookCommentRewritten || r.Header.Get(HeaderDelivery) == "" {
+			failures = append(failures, "missing event headers")
+		}
+
+		// The first attempt fails, so the delivery is retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event models.WebhookEvent
+		json.Unmarshal(payload, &event)
+		received <- event
+	}))
+	defer receiver.Close()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "webhooks.db"))
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	defer store.Close()
+
+	hook, err = store.Create("acme", models.WebhookRequest{URL: receiver.URL, Events: []string{models.WebhookCommentRewritten}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	dispatcher := NewDispatcher(store, &config.Config{
+		WebhookWorkers:     1,
+		WebhookMaxAttempts: 3,
+		WebhookBackoff:     10 * time.Millisecond,
+		WebhookTimeout:     time.Second,
+		WebhookQueueSize:   10,
+		// The receiver listens on loopback
+		WebhookAllowPrivate: true,
+	}, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Only subscribed events of the webhook's own tenant are delivered
+	dispatcher.Notify("globex", models.WebhookCommentRewritten, map[string]string{"comment": "other tenant"})
+	dispatcher.Notify("acme", models.WebhookCommentBlocked, map[string]string{"comment": "not subscribed"})
+	dispatcher.Notify("acme", models.WebhookCommentRewritten, map[string]string{"comment": "you idiot"})
+
+	select {
+	case event := <-received:
+		if event.Type != models.WebhookCommentRewritten || event.ID == "" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Errorf("%d attempts, want 2", attempts)
+	}
+	if len(failures) > 0 {
+		t.Errorf("receiver rejected deliveries: %v", failures)
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	d := &Dispatcher{backoff: time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{10, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := d.delay(tt.attempts); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	d := NewDispatcher(nil, &config.Config{}, logrus.New())
+
+	tests := []struct {
+		url       string
+		forbidden bool
+		invalid   bool
+	}{
+		{"https://93.184.216.34/hooks", false, false},
+		{"http://169.254.169.254/latest/meta-data/", true, false},
+		{"http://10.1.2.3/hooks", true, false},
+		{"http://192.168.0.10:8080/hooks", true, false},
+		{"http://172.16.0.1/hooks", true, false},
+		{"http://127.0.0.1/hooks", true, false},
+		{"http://[::1]/hooks", true, false},
+		{"http://[fe80::1]/hooks", true, false},
+		{"http://0.0.0.0/hooks", true, false},
+		{"http://localhost/hooks", true, false},
+		{"ftp://93.184.216.34/hooks", false, true},
+		{"not a url", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := d.CheckURL(context.Background(), tt.url)
+			switch {
+			case tt.forbidden && !errors.Is(err, ErrForbiddenAddress):
+				t.Errorf("got %v, want ErrForbiddenAddress", err)
+			case tt.invalid && (err == nil || errors.Is(err, ErrForbiddenAddress)):
+				t.Errorf("got %v, want an invalid URL error", err)
+			case !tt.forbidden && !tt.invalid && err != nil:
+				t.Errorf("got %v, want the URL accepted", err)
+			}
+		})
+	}
+
+	allowed := NewDispatcher(nil, &config.Config{WebhookAllowPrivate: true}, logrus.New())
+	if err := allowed.CheckURL(context.Background(), "http://127.0.0.1/hooks"); err != nil {
+		t.Errorf("with private addresses allowed: %v", err)
+	}
+}
+
+func TestDispatcherRefusesPrivateAddressesWhenSending(t *testing.T) {
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer receiver.Close()
+
+	store, err := OpenStore(filepath.Join(t.TempDir(), "webhooks.db"))
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	defer store.Close()
+
+	// Stored directly, as if its host had resolved to a public address at registration
+	hook, err := store.Create("acme", models.WebhookRequest{URL: receiver.URL, Events: []string{models.WebhookCommentRewritten}})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	dispatcher := NewDispatcher(store, &config.Config{WebhookMaxAttempts: 1, WebhookTimeout: time.Second}, logger)
+	delivery := &models.WebhookDelivery{ID: "d1", WebhookID: hook.ID, Event: models.WebhookCommentRewritten, Payload: []byte(`{}`)}
+
+	if _, err := dispatcher.send(context.Background(), hook, delivery); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("got %v, want ErrForbiddenAddress", err)
+	}
+	if hits.Load() != 0 {
+		t.Errorf("the receiver was reached %d times", hits.Load())
+	}
+}
+
+func TestNotifyDropsEventsWhenQueueIsFull(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	dispatcher := NewDispatcher(nil, &config.Config{WebhookQueueSize: 2}, logger)
+
+	// Nothing drains the queue, and Notify must not wait for it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			dispatcher.Notify("acme", models.WebhookCommentRewritten, map[string]int{"n": i})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notify blocked on a full queue")
+	}
+	if queued := len(dispatcher.events); queued != 2 {
+		t.Errorf("%d events queued, want 2", queued)
+	}
+}
@@ -0,0 +1,120 @@
+package llm
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// AdaptiveConfig tunes the AIMD controller of a model's bulkhead
+type AdaptiveConfig struct {
+	MinLimit         int
+	MaxLimit         int
+	Backoff          float64
+	LatencyTolerance float64
+}
+
+// latency samples needed before spikes are judged against the baseline
+const adaptiveWarmup = 20
+
+// AdaptiveLimiter grows a bulkhead's limit by one per window of successful
+// calls and cuts it multiplicatively when the provider throttles or latency
+// spikes above the smoothed baseline
+type AdaptiveLimiter struct {
+	bulkhead *Bulkhead
+	config   AdaptiveConfig
+
+	mu           sync.Mutex
+	limit        float64
+	baseline     time.Duration
+	samples      int
+	lastDecrease time.Time
+}
+
+func NewAdaptiveLimiter(bulkhead *Bulkhead, cfg AdaptiveConfig) *AdaptiveLimiter {
+	if cfg.MinLimit < 1 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit < cfg.MinLimit {
+		cfg.MaxLimit = cfg.MinLimit
+	}
+	if cfg.Backoff <= 0 || cfg.Backoff >= 1 {
+		cfg.Backoff = 0.5
+	}
+
+	start := math.Min(math.Max(float64(bulkhead.Limit()), float64(cfg.MinLimit)), float64(cfg.MaxLimit))
+	l := &AdaptiveLimiter{
+		bulkhead: bulkhead,
+		config:   cfg,
+		limit:    start,
+	}
+	bulkhead.SetLimit(int(start))
+	return l
+}
+
+// Success records a completed call and its latency
+func (l *AdaptiveLimiter) Success(latency time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	spike := l.samples >= adaptiveWarmup && l.config.LatencyTolerance > 0 &&
+		latency > time.Duration(float64(l.baseline)*l.config.LatencyTolerance)
+
+	// Spikes stay out of the baseline so a slow period can't become the new normal
+	if !spike {
+		if l.samples == 0 {
+			l.baseline = latency
+		} else {
+			l.baseline += (latency - l.baseline) / 10
+		}
+		l.samples++
+	}
+
+	if spike {
+		l.decrease("latency")
+		return
+	}
+
+	// Only grow while the current limit is actually being used
+	if l.bulkhead.InFlight()+1 < int(l.limit)/2 {
+		return
+	}
+	before := int(l.limit)
+	l.limit = math.Min(l.limit+1/l.limit, float64(l.config.MaxLimit))
+	if int(l.limit) > before {
+		adaptiveAdjustmentsTotal.WithLabelValues(l.bulkhead.name, "increase").Inc()
+		l.bulkhead.SetLimit(int(l.limit))
+	}
+}
+
+// Throttled records a rate-limit response from the provider
+func (l *AdaptiveLimiter) Throttled() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.decrease("throttled")
+}
+
+// cuts the limit at most once per typical call duration, so a burst of 429s
+// from calls that were already in flight counts as one signal; callers hold mu
+func (l *AdaptiveLimiter) decrease(reason string) {
+	window := l.baseline
+	if window < 100*time.Millisecond {
+		window = 100 * time.Millisecond
+	}
+	if time.Since(l.lastDecrease) < window {
+		return
+	}
+	l.lastDecrease = time.Now()
+
+	l.limit = math.Max(math.Floor(l.limit*l.config.Backoff), float64(l.config.MinLimit))
+	adaptiveAdjustmentsTotal.WithLabelValues(l.bulkhead.name, "decrease_"+reason).Inc()
+	l.bulkhead.SetLimit(int(l.limit))
+}
@@ -0,0 +1,115 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiterStartsWithinBounds(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		cfg   AdaptiveConfig
+		want  int
+	}{
+		{"within bounds", 8, AdaptiveConfig{MinLimit: 1, MaxLimit: 64}, 8},
+		{"raised to the minimum", 2, AdaptiveConfig{MinLimit: 4, MaxLimit: 64}, 4},
+		{"capped at the maximum", 100, AdaptiveConfig{MinLimit: 1, MaxLimit: 16}, 16},
+		{"maximum below minimum", 8, AdaptiveConfig{MinLimit: 10, MaxLimit: 2}, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBulkhead("test-adaptive-start", tt.limit, 0, 0)
+			NewAdaptiveLimiter(b, tt.cfg)
+			if b.Limit() != tt.want {
+				t.Errorf("limit %d, want %d", b.Limit(), tt.want)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiterBacksOffOnThrottle(t *testing.T) {
+	b := NewBulkhead("test-adaptive-throttle", 16, 0, 0)
+	l := NewAdaptiveLimiter(b, AdaptiveConfig{MinLimit: 3, MaxLimit: 64, Backoff: 0.5})
+
+	l.Throttled()
+	if b.Limit() != 8 {
+		t.Fatalf("limit %d after a throttle, want 8", b.Limit())
+	}
+
+	// A burst of throttles from calls already in flight counts once
+	l.Throttled()
+	l.Throttled()
+	if b.Limit() != 8 {
+		t.Fatalf("limit %d after a burst, want 8", b.Limit())
+	}
+
+	for _, want := range []int{4, 3, 3} {
+		l.mu.Lock()
+		l.lastDecrease = time.Time{}
+		l.mu.Unlock()
+		l.Throttled()
+		if b.Limit() != want {
+			t.Fatalf("limit %d, want %d", b.Limit(), want)
+		}
+	}
+}
+
+func TestAdaptiveLimiterGrowsUnderLoad(t *testing.T) {
+	b := NewBulkhead("test-adaptive-grow", 4, 0, 0)
+	l := NewAdaptiveLimiter(b, AdaptiveConfig{MinLimit: 1, MaxLimit: 5, LatencyTolerance: 2})
+
+	// Idle: successes with nothing in flight don't grow the limit
+	for i := 0; i < 20; i++ {
+		l.Success(10 * time.Millisecond)
+	}
+	if b.Limit() != 4 {
+		t.Fatalf("limit %d while idle, want 4", b.Limit())
+	}
+
+	// Busy: a window of about limit successes adds one slot
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		b.Acquire(ctx)
+	}
+	for i := 0; i < 5; i++ {
+		l.Success(10 * time.Millisecond)
+	}
+	if b.Limit() != 5 {
+		t.Fatalf("limit %d after a window under load, want 5", b.Limit())
+	}
+
+	// Never past the maximum
+	for i := 0; i < 50; i++ {
+		l.Success(10 * time.Millisecond)
+	}
+	if b.Limit() != 5 {
+		t.Errorf("limit %d, want it capped at 5", b.Limit())
+	}
+}
+
+func TestAdaptiveLimiterBacksOffOnLatencySpike(t *testing.T) {
+	b := NewBulkhead("test-adaptive-latency", 8, 0, 0)
+	l := NewAdaptiveLimiter(b, AdaptiveConfig{MinLimit: 1, MaxLimit: 8, Backoff: 0.5, LatencyTolerance: 2})
+
+	// Spikes aren't judged until the baseline has warmed up
+	l.Success(time.Second)
+	if b.Limit() != 8 {
+		t.Fatalf("limit %d during warmup, want 8", b.Limit())
+	}
+
+	for i := 0; i < adaptiveWarmup; i++ {
+		l.Success(10 * time.Millisecond)
+	}
+	l.Success(time.Second)
+	if b.Limit() != 4 {
+		t.Errorf("limit %d after a spike, want 4", b.Limit())
+	}
+}
+
+func TestAdaptiveLimiterNil(t *testing.T) {
+	var l *AdaptiveLimiter
+	l.Success(time.Second)
+	l.Throttled()
+}
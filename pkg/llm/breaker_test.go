@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAtThreshold(t *testing.T) {
+	b := NewCircuitBreaker("test-breaker-threshold", 3, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		b.Failure()
+	}
+	if b.State() != CircuitClosed {
+		t.Fatalf("state %s after 2 failures, want closed", b.State())
+	}
+
+	// A success resets the count
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if b.State() != CircuitClosed {
+		t.Fatalf("state %s, want closed after the count was reset", b.State())
+	}
+
+	b.Failure()
+	if b.State() != CircuitOpen {
+		t.Fatalf("state %s at the threshold, want open", b.State())
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Allow while open: %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	tests := []struct {
+		name   string
+		settle func(b *CircuitBreaker)
+		want   CircuitState
+	}{
+		{"probe succeeds", (*CircuitBreaker).Success, CircuitClosed},
+		{"probe fails", (*CircuitBreaker).Failure, CircuitOpen},
+		{"probe released", (*CircuitBreaker).Release, CircuitHalfOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker("test-breaker-probe", 1, 10*time.Millisecond)
+			b.Failure()
+			if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("Allow before the cooldown: %v, want ErrCircuitOpen", err)
+			}
+
+			time.Sleep(15 * time.Millisecond)
+			if b.State() != CircuitHalfOpen {
+				t.Fatalf("state %s after the cooldown, want half-open", b.State())
+			}
+			if err := b.Allow(); err != nil {
+				t.Fatalf("probe: %v", err)
+			}
+			// Only one probe at a time
+			if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("second probe: %v, want ErrCircuitOpen", err)
+			}
+
+			tt.settle(b)
+			if b.State() != tt.want {
+				t.Errorf("state %s, want %s", b.State(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := NewCircuitBreaker("test-breaker-disabled", 0, time.Hour)
+	for i := 0; i < 10; i++ {
+		b.Failure()
+		if err := b.Allow(); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is returned when a model's bulkhead queue is full or the wait timed out
+var ErrOverloaded = errors.New("model is overloaded")
+
+// OverloadedError tells callers how long to wait before trying again
+type OverloadedError struct {
+	Model      string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("model %s is overloaded: %s", e.Model, e.Reason)
+}
+
+func (e *OverloadedError) Is(target error) bool {
+	return target == ErrOverloaded
+}
+
+// RetryAfter returns the back-off hint carried by an overload error, if any
+func RetryAfter(err error) (time.Duration, bool) {
+	var overloaded *OverloadedError
+	if errors.As(err, &overloaded) {
+		return overloaded.RetryAfter, true
+	}
+	return 0, false
+}
+
+// Bulkhead bounds concurrent calls to a model, queueing up to maxQueue callers
+// for at most queueTimeout. The limit can be changed at runtime; a bulkhead
+// created with a limit of 0 never blocks.
+type Bulkhead struct {
+	name         string
+	unbounded    bool
+	maxQueue     int
+	queueTimeout time.Duration
+
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	waiters  []chan struct{}
+}
+
+func NewBulkhead(name string, limit, maxQueue int, queueTimeout time.Duration) *Bulkhead {
+	b := &Bulkhead{
+		name:         name,
+		unbounded:    limit <= 0,
+		limit:        limit,
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+	}
+	concurrencyLimit.WithLabelValues(name).Set(float64(limit))
+	return b
+}
+
+// Acquire waits for a slot; every successful Acquire must be paired with Release
+func (b *Bulkhead) Acquire(ctx context.Context) error {
+	if b.unbounded {
+		return nil
+	}
+	start := time.Now()
+
+	b.mu.Lock()
+	if b.inflight < b.limit && len(b.waiters) == 0 {
+		b.inflight++
+		b.observe()
+		b.mu.Unlock()
+		queueWait.WithLabelValues(b.name).Observe(0)
+		return nil
+	}
+	if len(b.waiters) >= b.maxQueue {
+		b.mu.Unlock()
+		bulkheadRejected.WithLabelValues(b.name, "queue_full").Inc()
+		return &OverloadedError{Model: b.name, Reason: "queue full", RetryAfter: b.retryAfter()}
+	}
+	ready := make(chan struct{})
+	b.waiters = append(b.waiters, ready)
+	b.observe()
+	b.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if b.queueTimeout > 0 {
+		timer := time.NewTimer(b.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ready:
+		queueWait.WithLabelValues(b.name).Observe(time.Since(start).Seconds())
+		return nil
+	case <-ctx.Done():
+		b.abandon(ready)
+		return ctx.Err()
+	case <-timeout:
+		b.abandon(ready)
+		bulkheadRejected.WithLabelValues(b.name, "queue_timeout").Inc()
+		return &OverloadedError{Model: b.name, Reason: "timed out waiting in queue", RetryAfter: b.retryAfter()}
+	}
+}
+
+// Release frees a slot and hands it to the next waiter
+func (b *Bulkhead) Release() {
+	if b.unbounded {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inflight--
+	b.grant()
+}
+
+// SetLimit changes the number of concurrent calls allowed (at least 1)
+func (b *Bulkhead) SetLimit(limit int) {
+	if b.unbounded {
+		return
+	}
+	if limit < 1 {
+		limit = 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.limit = limit
+	concurrencyLimit.WithLabelValues(b.name).Set(float64(limit))
+	b.grant()
+}
+
+// Limit returns the current concurrency limit
+func (b *Bulkhead) Limit() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limit
+}
+
+// InFlight returns the number of calls currently holding a slot
+func (b *Bulkhead) InFlight() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.inflight
+}
+
+// gives a waiter up, returning its slot if it was granted meanwhile
+func (b *Bulkhead) abandon(ready chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, w := range b.waiters {
+		if w == ready {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+			b.observe()
+			return
+		}
+	}
+	b.inflight--
+	b.grant()
+}
+
+// hands free slots to waiters in arrival order; callers hold mu
+func (b *Bulkhead) grant() {
+	for b.inflight < b.limit && len(b.waiters) > 0 {
+		ready := b.waiters[0]
+		b.waiters = b.waiters[1:]
+		b.inflight++
+		close(ready)
+	}
+	b.observe()
+}
+
+func (b *Bulkhead) observe() {
+	inflightGauge.WithLabelValues(b.name).Set(float64(b.inflight))
+	queueDepth.WithLabelValues(b.name).Set(float64(len(b.waiters)))
+}
+
+// suggests retrying once a queue's worth of waiting has drained
+func (b *Bulkhead) retryAfter() time.Duration {
+	if b.queueTimeout > 0 {
+		return b.queueTimeout
+	}
+	return time.Second
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBulkheadLimitsConcurrency(t *testing.T) {
+	b := NewBulkhead("test-bulkhead-limit", 2, 1, time.Second)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := b.Acquire(ctx); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+
+	// The third call queues until a slot frees
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.Acquire(ctx) }()
+	waitFor(t, func() bool { return queued(b) == 1 })
+
+	// The queue holds one, so a fourth is turned away
+	err := b.Acquire(ctx)
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("fourth acquire: %v, want ErrOverloaded", err)
+	}
+	if retry, ok := RetryAfter(err); !ok || retry != time.Second {
+		t.Errorf("RetryAfter = %v %v, want the queue timeout", retry, ok)
+	}
+
+	b.Release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("queued acquire: %v", err)
+	}
+	if b.InFlight() != 2 {
+		t.Errorf("in flight %d, want 2", b.InFlight())
+	}
+}
+
+func TestBulkheadQueueExits(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		want    error
+	}{
+		{"queue timeout", 20 * time.Millisecond, false, ErrOverloaded},
+		{"caller cancels", time.Minute, true, context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBulkhead("test-bulkhead-exit", 1, 4, tt.timeout)
+			if err := b.Acquire(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			acquired := make(chan error, 1)
+			go func() { acquired <- b.Acquire(ctx) }()
+			waitFor(t, func() bool { return queued(b) == 1 })
+			if tt.cancel {
+				cancel()
+			}
+
+			if err := <-acquired; !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if queued(b) != 0 || b.InFlight() != 1 {
+				t.Errorf("queued %d in flight %d after the waiter left, want 0 1", queued(b), b.InFlight())
+			}
+
+			// The slot is still usable by the next caller
+			b.Release()
+			if err := b.Acquire(context.Background()); err != nil {
+				t.Errorf("acquire after release: %v", err)
+			}
+		})
+	}
+}
+
+func TestBulkheadSetLimitGrantsWaiters(t *testing.T) {
+	b := NewBulkhead("test-bulkhead-setlimit", 1, 4, time.Second)
+	ctx := context.Background()
+	b.Acquire(ctx)
+
+	acquired := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { acquired <- b.Acquire(ctx) }()
+	}
+	waitFor(t, func() bool { return queued(b) == 2 })
+
+	b.SetLimit(3)
+	for i := 0; i < 2; i++ {
+		if err := <-acquired; err != nil {
+			t.Fatalf("waiter %d: %v", i, err)
+		}
+	}
+	if b.InFlight() != 3 {
+		t.Errorf("in flight %d, want 3", b.InFlight())
+	}
+
+	b.SetLimit(0)
+	if b.Limit() != 1 {
+		t.Errorf("limit %d, want it floored at 1", b.Limit())
+	}
+}
+
+func TestBulkheadUnbounded(t *testing.T) {
+	b := NewBulkhead("test-bulkhead-unbounded", 0, 0, 0)
+	for i := 0; i < 100; i++ {
+		if err := b.Acquire(context.Background()); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+}
+
+func queued(b *Bulkhead) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.waiters)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
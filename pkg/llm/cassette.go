@@ -0,0 +1,229 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	CassetteOff    = "off"
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// ErrCassetteMiss is returned in replay mode when no recording matches a prompt
+var ErrCassetteMiss = errors.New("no cassette entry for prompt")
+
+// CassetteEntry is a single recorded LLM call
+type CassetteEntry struct {
+	Key        string          `json:"key"`
+	Model      string          `json:"model"`
+	Prompt     string          `json:"prompt"`
+	Options    CassetteOptions `json:"options"`
+	Response   string          `json:"response"`
+	RecordedAt time.Time       `json:"recorded_at"`
+}
+
+// CassetteOptions - generation options the call was made with
+type CassetteOptions struct {
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+	Temperature float64 `json:"temperature,omitempty"`
+}
+
+// Cassette records LLM traffic to a JSON lines file or replays it back
+type Cassette struct {
+	mode string
+	mu   sync.Mutex
+	file *os.File
+
+	entries map[string][]CassetteEntry
+	served  map[string]int
+}
+
+// OpenCassette opens path for recording (append) or replay (read all entries)
+func OpenCassette(mode, path string) (*Cassette, error) {
+	c := &Cassette{mode: mode}
+
+	switch mode {
+	case CassetteRecord:
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open cassette: %w", err)
+		}
+		c.file = file
+	case CassetteReplay:
+		entries, err := readCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		c.entries = entries
+		c.served = make(map[string]int)
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q", mode)
+	}
+
+	return c, nil
+}
+
+func readCassette(path string) (map[string][]CassetteEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette: %w", err)
+	}
+	defer file.Close()
+
+	entries := make(map[string][]CassetteEntry)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry CassetteEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid cassette entry on line %d: %w", line, err)
+		}
+		entries[entry.Key] = append(entries[entry.Key], entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	return entries, nil
+}
+
+// PromptKey hashes the model and prompt into a cassette lookup key
+func PromptKey(model, prompt string) string {
+	sum := sha256.Sum256([]byte(model + "\n" + prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// Wrap returns a model that records or replays calls made to model. When
+// replaying, model may be nil.
+func (c *Cassette) Wrap(model llms.Model, name string) llms.Model {
+	return &cassetteModel{cassette: c, model: model, name: name}
+}
+
+// Replaying reports whether calls are answered from the cassette alone
+func (c *Cassette) Replaying() bool {
+	return c.mode == CassetteReplay
+}
+
+// Close flushes and closes the cassette file
+func (c *Cassette) Close() error {
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+func (c *Cassette) record(entry CassetteEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.file.Write(append(data, '\n'))
+	return err
+}
+
+// replays recordings for a key in order, repeating the last one once exhausted
+func (c *Cassette) replay(key string) (CassetteEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	recorded := c.entries[key]
+	if len(recorded) == 0 {
+		return CassetteEntry{}, false
+	}
+	i := c.served[key]
+	if i >= len(recorded) {
+		i = len(recorded) - 1
+	}
+	c.served[key] = i + 1
+	return recorded[i], true
+}
+
+type cassetteModel struct {
+	cassette *Cassette
+	model    llms.Model
+	name     string
+}
+
+func (m *cassetteModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	prompt := promptText(messages)
+	key := PromptKey(m.name, prompt)
+
+	if m.cassette.mode == CassetteReplay {
+		entry, ok := m.cassette.replay(key)
+		if !ok {
+			return nil, fmt.Errorf("%w (model %s, key %s)", ErrCassetteMiss, m.name, key)
+		}
+		if err := streamText(ctx, options, entry.Response); err != nil {
+			return nil, err
+		}
+		return &llms.ContentResponse{
+			Choices: []*llms.ContentChoice{{Content: entry.Response, StopReason: "stop"}},
+		}, nil
+	}
+
+	resp, err := m.model.GenerateContent(ctx, messages, options...)
+	if err != nil || len(resp.Choices) == 0 {
+		return resp, err
+	}
+
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	entry := CassetteEntry{
+		Key:    key,
+		Model:  m.name,
+		Prompt: prompt,
+		Options: CassetteOptions{
+			MaxTokens:   opts.MaxTokens,
+			Temperature: opts.Temperature,
+		},
+		Response:   resp.Choices[0].Content,
+		RecordedAt: time.Now(),
+	}
+	if err := m.cassette.record(entry); err != nil {
+		return nil, fmt.Errorf("failed to record cassette entry: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (m *cassetteModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+// joins the text parts of every message
+func promptText(messages []llms.MessageContent) string {
+	var prompt strings.Builder
+	for _, msg := range messages {
+		for _, part := range msg.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				prompt.WriteString(text.Text)
+			}
+		}
+	}
+	return prompt.String()
+}
@@ -0,0 +1,100 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/harshaSenaratne/reword/internal/config"
+)
+
+func TestCassetteRecordThenReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm.jsonl")
+	ctx := context.Background()
+	prompt := "Original comment: \"you idiot\"\nModerated comment:"
+
+	t.Setenv("MODERATOR_PROVIDER", "fake")
+	t.Setenv("ASSISTANT_PROVIDER", "fake")
+	t.Setenv("LLM_CASSETTE_MODE", CassetteRecord)
+	t.Setenv("LLM_CASSETTE_PATH", path)
+	recorder := newTestClient(t)
+	recorded, err := recorder.Generate(ctx, RoleModerator, prompt)
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	recorder.Close()
+
+	// Replay needs neither a reachable provider nor its credentials
+	t.Setenv("MODERATOR_PROVIDER", "openai")
+	t.Setenv("ASSISTANT_PROVIDER", "openai")
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("LLM_CASSETTE_MODE", CassetteReplay)
+	player := newTestClient(t)
+	defer player.Close()
+
+	replayed, err := player.Generate(ctx, RoleModerator, prompt)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replayed.Text != recorded.Text || replayed.Model != recorded.Model {
+		t.Errorf("replayed %q from %s, recorded %q from %s", replayed.Text, replayed.Model, recorded.Text, recorded.Model)
+	}
+
+	if _, err := player.Generate(ctx, RoleModerator, "a prompt that was never recorded"); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("unrecorded prompt: got %v, want ErrCassetteMiss", err)
+	}
+}
+
+func TestCassetteReplaysInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "llm.jsonl")
+	ctx := context.Background()
+
+	rules, err := NewFakeModel(config.ModelConfig{Provider: "fake", Model: "fake-model"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := OpenCassette(CassetteRecord, path)
+	if err != nil {
+		t.Fatalf("OpenCassette: %v", err)
+	}
+	model := recorder.Wrap(rules, "fake-model")
+	for _, prompt := range []string{"Original comment: \"first\"\nMasked comment:", "Original comment: \"second\"\nMasked comment:"} {
+		if _, err := model.Call(ctx, prompt); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	player, err := OpenCassette(CassetteReplay, path)
+	if err != nil {
+		t.Fatalf("OpenCassette: %v", err)
+	}
+	replay := player.Wrap(nil, "fake-model")
+	for _, want := range []string{"second", "first", "first"} {
+		got, err := replay.Call(ctx, "Original comment: \""+want+"\"\nMasked comment:")
+		if err != nil || got != want {
+			t.Errorf("got %q, %v, want %q", got, err, want)
+		}
+	}
+
+	// Keys include the model, so another model's recordings don't match
+	if _, err := player.Wrap(nil, "other-model").Call(ctx, "Original comment: \"first\"\nMasked comment:"); !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("other model: got %v, want ErrCassetteMiss", err)
+	}
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
@@ -2,63 +2,297 @@ package llm
 
 import (
     "context"
+    "errors"
     "fmt"
     "github.com/tmc/langchaingo/llms"
-    "github.com/tmc/langchaingo/llms/openai"
     "github.com/harshaSenaratne/reword/internal/config"
 )
 
+// Role selects which model chain serves a call
+type Role string
+
+const (
+    RoleAssistant Role = "assistant"
+    RoleModerator Role = "moderator"
+)
+
+// Generation is the text returned for a call, the model that produced it and
+// the tokens it spent
+type Generation struct {
+    Text     string
+    Model    string
+    Fallback bool
+    Usage    TokenUsage
+}
+
+type roleModel struct {
+    name  string
+    model llms.Model
+}
+
+// Embedder is implemented by provider models that can embed text
+type Embedder interface {
+    CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error)
+}
+
 type Client struct {
-    assistantLLM llms.Model
-    moderatorLLM llms.Model
-    config       *config.Config
+    chains   map[Role][]roleModel
+    embedder Embedder
+    cassette *Cassette
+    breakers  map[string]*CircuitBreaker
+    bulkheads map[string]*Bulkhead
+    limiters  map[string]*AdaptiveLimiter
+    config    *config.Config
 }
 
 func NewClient(cfg *config.Config) (*Client, error) {
-    // Create assistant LLM
-    assistantLLM, err := openai.New(
-        openai.WithToken(cfg.OpenAIAPIKey),
-        openai.WithModel(cfg.AssistantModel),
-    )
+    c := &Client{
+        chains:   make(map[Role][]roleModel),
+        breakers:  make(map[string]*CircuitBreaker),
+        bulkheads: make(map[string]*Bulkhead),
+        limiters:  make(map[string]*AdaptiveLimiter),
+        config:    cfg,
+    }
+
+    // Record or replay traffic through a cassette when enabled
+    if cfg.CassetteMode != "" && cfg.CassetteMode != CassetteOff {
+        cassette, err := OpenCassette(cfg.CassetteMode, cfg.CassettePath)
+        if err != nil {
+            return nil, err
+        }
+        c.cassette = cassette
+    }
+
+    // Create assistant LLM chain
+    assistant, err := c.buildChain(append([]config.ModelConfig{cfg.Assistant}, cfg.AssistantFallbacks...))
     if err != nil {
         return nil, fmt.Errorf("failed to create assistant LLM: %w", err)
     }
+    c.chains[RoleAssistant] = assistant
 
-    // Create moderator LLM
-    moderatorLLM, err := openai.New(
-        openai.WithToken(cfg.OpenAIAPIKey),
-        openai.WithModel(cfg.ModeratorModel),
-    )
+    // Create moderator LLM chain
+    moderator, err := c.buildChain(append([]config.ModelConfig{cfg.Moderator}, cfg.ModeratorFallbacks...))
     if err != nil {
         return nil, fmt.Errorf("failed to create moderator LLM: %w", err)
     }
+    c.chains[RoleModerator] = moderator
 
-    return &Client{
-        assistantLLM: assistantLLM,
-        moderatorLLM: moderatorLLM,
-        config:       cfg,
-    }, nil
+    // Create embedder only when something needs it
+    if cfg.SemanticCacheEnabled {
+        model, err := NewModel(cfg.Embedding)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create embedding model: %w", err)
+        }
+        embedder, ok := model.(Embedder)
+        if !ok {
+            return nil, fmt.Errorf("provider %s does not support embeddings", cfg.Embedding.Provider)
+        }
+        c.embedder = embedder
+    }
+
+    return c, nil
 }
 
-func (c *Client) GetAssistantLLM() llms.Model {
-    return c.assistantLLM
+// builds the ordered models for a role, primary first
+func (c *Client) buildChain(configs []config.ModelConfig) ([]roleModel, error) {
+    chain := make([]roleModel, 0, len(configs))
+    for _, mc := range configs {
+        // Replay never reaches a provider, so none is built and no credentials are needed
+        var model llms.Model
+        if c.cassette == nil || !c.cassette.Replaying() {
+            var err error
+            model, err = NewModel(mc)
+            if err != nil {
+                return nil, fmt.Errorf("%s: %w", mc.Model, err)
+            }
+        }
+        if c.cassette != nil {
+            model = c.cassette.Wrap(model, mc.Model)
+        }
+        chain = append(chain, roleModel{name: mc.Model, model: c.withResilience(model, mc.Model)})
+    }
+    return chain, nil
 }
 
-func (c *Client) GetModeratorLLM() llms.Model {
-    return c.moderatorLLM
+// wraps a model with retries, and the breaker and bulkhead shared by every role using the same model
+func (c *Client) withResilience(model llms.Model, name string) llms.Model {
+    breaker, ok := c.breakers[name]
+    if !ok {
+        breaker = NewCircuitBreaker(name, c.config.BreakerThreshold, c.config.BreakerCooldown)
+        c.breakers[name] = breaker
+    }
+
+    bulkhead, ok := c.bulkheads[name]
+    if !ok {
+        limit := c.config.MaxConcurrency
+        if override, ok := c.config.ModelConcurrency[name]; ok {
+            limit = override
+        }
+        bulkhead = NewBulkhead(name, limit, c.config.MaxQueue, c.config.QueueTimeout)
+        c.bulkheads[name] = bulkhead
+
+        // An unbounded bulkhead has nothing to adapt
+        if c.config.AdaptiveConcurrency && limit > 0 {
+            c.limiters[name] = NewAdaptiveLimiter(bulkhead, AdaptiveConfig{
+                MinLimit:         c.config.MinConcurrency,
+                MaxLimit:         c.config.AdaptiveMaxConcurrency,
+                Backoff:          c.config.AdaptiveBackoff,
+                LatencyTolerance: c.config.AdaptiveLatencyTolerance,
+            })
+        }
+    }
+
+    return &resilientModel{
+        model: model,
+        name:  name,
+        policy: RetryPolicy{
+            MaxRetries: c.config.MaxRetries,
+            BaseDelay:  c.config.RetryBaseDelay,
+            MaxDelay:   c.config.RetryMaxDelay,
+        },
+        breaker:  breaker,
+        bulkhead: bulkhead,
+        limiter:  c.limiters[name],
+    }
+}
+
+// CircuitStates reports the breaker state of every configured model
+func (c *Client) CircuitStates() map[string]string {
+    states := make(map[string]string, len(c.breakers))
+    for name, breaker := range c.breakers {
+        states[name] = breaker.State().String()
+    }
+    return states
 }
 
-func (c *Client) GenerateResponse(ctx context.Context, llm llms.Model, prompt string) (string, error) {
-    response, err := llms.GenerateFromSinglePrompt(
-        ctx,
-        llm,
-        prompt,
+// Close releases the cassette file, if any
+func (c *Client) Close() error {
+    if c.cassette == nil {
+        return nil
+    }
+    return c.cassette.Close()
+}
+
+// Models lists the chain configured for role, primary first
+func (c *Client) Models(role Role) []string {
+    names := make([]string, 0, len(c.chains[role]))
+    for _, m := range c.chains[role] {
+        names = append(names, m.name)
+    }
+    return names
+}
+
+// EmbeddingModel names the configured embedding model, empty when disabled
+func (c *Client) EmbeddingModel() string {
+    if c.embedder == nil {
+        return ""
+    }
+    return c.config.Embedding.Model
+}
+
+// Embed returns the embedding vector for text and the tokens it spent.
+// Embedding APIs bill the input only, counted locally.
+func (c *Client) Embed(ctx context.Context, text string) ([]float32, TokenUsage, error) {
+    if c.embedder == nil {
+        return nil, TokenUsage{}, fmt.Errorf("no embedding model configured")
+    }
+
+    vectors, err := c.embedder.CreateEmbedding(ctx, []string{text})
+    if err != nil {
+        return nil, TokenUsage{}, fmt.Errorf("failed to embed text: %w", err)
+    }
+    if len(vectors) == 0 {
+        return nil, TokenUsage{}, fmt.Errorf("failed to embed text: empty response")
+    }
+
+    model := c.config.Embedding.Model
+    usage := TokenUsage{PromptTokens: CountTokens(model, text)}
+    tokensTotal.WithLabelValues("embedding", model, "prompt").Add(float64(usage.PromptTokens))
+    return vectors[0], usage, nil
+}
+
+// Generate runs prompt against the role's models in order, falling through to
+// the next one on error, timeout or an open circuit
+func (c *Client) Generate(ctx context.Context, role Role, prompt string, options ...llms.CallOption) (*Generation, error) {
+    chain := c.chains[role]
+    if len(chain) == 0 {
+        return nil, fmt.Errorf("no models configured for role %s", role)
+    }
+
+    var errs []error
+    for i, m := range chain {
+        response, err := c.generateWith(ctx, m.model, prompt, options)
+        if err == nil {
+            if i > 0 {
+                fallbacksTotal.WithLabelValues(string(role), m.name).Inc()
+            }
+            usage := usageFrom(m.name, prompt, response)
+            tokensTotal.WithLabelValues(string(role), m.name, "prompt").Add(float64(usage.PromptTokens))
+            tokensTotal.WithLabelValues(string(role), m.name, "completion").Add(float64(usage.CompletionTokens))
+            return &Generation{Text: response.Choices[0].Content, Model: m.name, Fallback: i > 0, Usage: usage}, nil
+        }
+
+        errs = append(errs, fmt.Errorf("%s: %w", m.name, err))
+        if ctx.Err() != nil {
+            break
+        }
+    }
+
+    // Only report overload when every model was overloaded, so callers can back off
+    overloaded := len(errs) > 0
+    for _, err := range errs {
+        if !errors.Is(err, ErrOverloaded) {
+            overloaded = false
+        }
+    }
+    if overloaded {
+        return nil, errs[len(errs)-1]
+    }
+    // Otherwise keep the overloaded ones out of errors.Is, so the failure isn't reported as overload
+    for i, err := range errs {
+        if errors.Is(err, ErrOverloaded) {
+            errs[i] = errors.New(err.Error())
+        }
+    }
+
+    return nil, fmt.Errorf("failed to generate response: %w", errors.Join(errs...))
+}
+
+// CountTokens counts text with the tokenizer of the role's primary model
+func (c *Client) CountTokens(role Role, text string) int {
+    return CountTokens(c.primary(role), text)
+}
+
+// TruncateTokens cuts text to limit tokens of the role's primary model
+func (c *Client) TruncateTokens(role Role, text string, limit int) string {
+    return TruncateTokens(c.primary(role), text, limit)
+}
+
+func (c *Client) primary(role Role) string {
+    if chain := c.chains[role]; len(chain) > 0 {
+        return chain[0].name
+    }
+    return ""
+}
+
+func (c *Client) generateWith(ctx context.Context, model llms.Model, prompt string, options []llms.CallOption) (*llms.ContentResponse, error) {
+    if c.config.ModelTimeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, c.config.ModelTimeout)
+        defer cancel()
+    }
+
+    options = append([]llms.CallOption{
         llms.WithMaxTokens(c.config.MaxTokens),
         llms.WithTemperature(c.config.Temperature),
-    )
+    }, options...)
+
+    resp, err := model.GenerateContent(ctx, []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, prompt)}, options...)
     if err != nil {
-        return "", fmt.Errorf("failed to generate response: %w", err)
+        return nil, err
     }
-    
-    return response, nil
-}
\ No newline at end of file
+    if len(resp.Choices) == 0 {
+        return nil, errors.New("empty response from model")
+    }
+    return resp, nil
+}
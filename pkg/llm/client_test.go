@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateFallsBack(t *testing.T) {
+	badRequest := &APIError{StatusCode: 400, Err: errors.New("bad request")}
+	overloaded := &OverloadedError{Model: "primary", Reason: "queue full"}
+
+	tests := []struct {
+		name       string
+		primary    []error
+		fallback   []error
+		model      string
+		calls      [2]int
+		overloaded bool
+	}{
+		{"primary answers", nil, nil, "primary", [2]int{1, 0}, false},
+		{"fallback after the primary fails", []error{badRequest}, nil, "fallback", [2]int{1, 1}, false},
+		{"every model fails", []error{badRequest}, []error{badRequest}, "", [2]int{1, 1}, false},
+		{"every model overloaded", []error{overloaded}, []error{overloaded}, "", [2]int{1, 1}, true},
+		{"partly overloaded", []error{overloaded}, []error{badRequest}, "", [2]int{1, 1}, false},
+	}
+
+	t.Setenv("MODERATOR_PROVIDER", "fake")
+	t.Setenv("ASSISTANT_PROVIDER", "fake")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t)
+			defer client.Close()
+			primary := &scriptedModel{errs: tt.primary}
+			fallback := &scriptedModel{errs: tt.fallback}
+			client.chains[RoleModerator] = []roleModel{{name: "primary", model: primary}, {name: "fallback", model: fallback}}
+
+			generation, err := client.Generate(context.Background(), RoleModerator, "hello")
+			if calls := [2]int{primary.calls, fallback.calls}; calls != tt.calls {
+				t.Errorf("calls %v, want %v", calls, tt.calls)
+			}
+			if tt.model == "" {
+				if err == nil {
+					t.Fatalf("got %q from %s, want an error", generation.Text, generation.Model)
+				}
+				if errors.Is(err, ErrOverloaded) != tt.overloaded {
+					t.Errorf("overloaded = %v, want %v: %v", !tt.overloaded, tt.overloaded, err)
+				}
+				if !tt.overloaded && (!strings.Contains(err.Error(), "primary") || !strings.Contains(err.Error(), "fallback")) {
+					t.Errorf("error doesn't name every model: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if generation.Model != tt.model || generation.Fallback != (tt.model != "primary") {
+				t.Errorf("answered by %s (fallback %v), want %s", generation.Model, generation.Fallback, tt.model)
+			}
+		})
+	}
+}
+
+func TestGenerateStopsFallingBackOnCancel(t *testing.T) {
+	t.Setenv("MODERATOR_PROVIDER", "fake")
+	t.Setenv("ASSISTANT_PROVIDER", "fake")
+	client := newTestClient(t)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	primary := &scriptedModel{errs: []error{context.Canceled}}
+	fallback := &scriptedModel{}
+	client.chains[RoleModerator] = []roleModel{{name: "primary", model: primary}, {name: "fallback", model: fallback}}
+
+	cancel()
+	if _, err := client.Generate(ctx, RoleModerator, "hello"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if fallback.calls != 0 {
+		t.Errorf("fallback called %d times after the caller left", fallback.calls)
+	}
+}
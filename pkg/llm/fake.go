@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/harshaSenaratne/reword/internal/config"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// FakeRule maps a prompt pattern to a canned response. The response may
+// reference capture groups ($1, ${name}); Error makes the rule fail instead,
+// as an upstream HTTP failure when Status is set. DelayMS holds the answer
+// back, to simulate a slow provider.
+type FakeRule struct {
+	Match    string `json:"match"`
+	Response string `json:"response"`
+	Error    string `json:"error,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	DelayMS  int    `json:"delay_ms,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// FakeModel answers prompts offline from a list of scripted rules
+type FakeModel struct {
+	model string
+	rules []FakeRule
+}
+
+// rules used when no rules file is configured, covering every prompt the services send
+var defaultFakeRules = []FakeRule{
+	{Match: `(?is)Analyze if the following comment.*Comment: ".*\b(dies?|kill|hurt you)\b`, Response: `{"verdict": "toxic", "scores": {"threat": 0.95, "harassment": 0.7}, "confidence": 0.9, "reason": "The comment wishes harm on someone"}`},
+	{Match: `(?is)Analyze if the following comment.*Comment: ".*\b(idiot|stupid|hate|trash)\b`, Response: `{"verdict": "toxic", "scores": {"harassment": 0.8, "profanity": 0.3}, "confidence": 0.9, "reason": "The comment contains insulting language"}`},
+	{Match: `(?is)Analyze if the following comment.*Comment: ".*\b(damn|crap|sucks)\b`, Response: `{"verdict": "toxic", "scores": {"profanity": 0.6}, "confidence": 0.8, "reason": "The comment contains mild profanity"}`},
+	{Match: `(?is)Analyze if the following comment`, Response: `{"verdict": "clean", "scores": {}, "confidence": 0.9, "reason": "The comment is appropriate"}`},
+	{Match: `(?is)Original comment: "(.*)"\s*Masked comment:`, Response: "$1"},
+	{Match: `(?is)Original comment: ".*"\s*Moderated comment:`, Response: "I am unhappy with this and would like it to be improved."},
+	{Match: `(?is)Analyze the sentiment.*Comment: ".*\b(love|great|thanks|thank you|excellent|awesome|good)\b`, Response: "positive"},
+	{Match: `(?is)Analyze the sentiment.*Comment: ".*\b(bad|terrible|awful|worst|hate|unhappy|broken)\b`, Response: "negative"},
+	{Match: `(?is)Analyze the sentiment`, Response: "neutral"},
+	{Match: `(?is)You are an? .* assistant`, Response: "Thank you for your comment. We appreciate you taking the time to share your thoughts."},
+}
+
+// NewFakeModel builds a fake model from cfg.RulesFile, or the default rules when unset
+func NewFakeModel(cfg config.ModelConfig) (llms.Model, error) {
+	rules := defaultFakeRules
+	if cfg.RulesFile != "" {
+		data, err := os.ReadFile(cfg.RulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fake rules file: %w", err)
+		}
+		rules = nil
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, fmt.Errorf("failed to parse fake rules file: %w", err)
+		}
+	}
+
+	compiled := make([]FakeRule, len(rules))
+	for i, rule := range rules {
+		pattern, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fake rule %d: %w", i, err)
+		}
+		rule.pattern = pattern
+		compiled[i] = rule
+	}
+
+	return &FakeModel{model: cfg.Model, rules: compiled}, nil
+}
+
+// GenerateContent answers with the first rule matching the prompt text
+func (f *FakeModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	text := promptText(messages)
+
+	for _, rule := range f.rules {
+		match := rule.pattern.FindStringSubmatchIndex(text)
+		if match == nil {
+			continue
+		}
+		if rule.DelayMS > 0 {
+			timer := time.NewTimer(time.Duration(rule.DelayMS) * time.Millisecond)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		if rule.Error != "" {
+			if rule.Status != 0 {
+				return nil, &APIError{StatusCode: rule.Status, Err: errors.New(rule.Error)}
+			}
+			return nil, errors.New(rule.Error)
+		}
+		content := rule.pattern.ExpandString(nil, rule.Response, text, match)
+		if err := streamText(ctx, options, string(content)); err != nil {
+			return nil, err
+		}
+		return &llms.ContentResponse{
+			Choices: []*llms.ContentChoice{{Content: string(content), StopReason: "stop"}},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("fake model %s: no rule matched prompt", f.model)
+}
+
+// Call implements the legacy single prompt interface
+func (f *FakeModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, f, prompt, options...)
+}
+
+// dimensions of the vectors returned by the fake embedder
+const fakeEmbeddingSize = 256
+
+// CreateEmbedding returns deterministic character trigram vectors, so texts
+// differing by a word or two land close together
+func (f *FakeModel) CreateEmbedding(ctx context.Context, texts []string) ([][]float32, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, fakeEmbeddingSize)
+		runes := []rune(" " + strings.ToLower(text) + " ")
+		for j := 0; j+3 <= len(runes); j++ {
+			h := fnv.New32a()
+			h.Write([]byte(string(runes[j : j+3])))
+			vector[h.Sum32()%fakeEmbeddingSize]++
+		}
+
+		var norm float64
+		for _, v := range vector {
+			norm += float64(v) * float64(v)
+		}
+		if norm > 0 {
+			scale := float32(1 / math.Sqrt(norm))
+			for j := range vector {
+				vector[j] *= scale
+			}
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
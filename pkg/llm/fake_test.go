@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/harshaSenaratne/reword/internal/config"
+	"github.com/tmc/langchaingo/llms"
+)
+
+func TestFakeModelDefaultRules(t *testing.T) {
+	model, err := NewFakeModel(config.ModelConfig{Provider: "fake", Model: "fake-model"})
+	if err != nil {
+		t.Fatalf("NewFakeModel: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		prompt string
+		want   string
+	}{
+		{"clean", "Analyze if the following comment is toxic.\nComment: \"Thanks for the quick reply\"", `"verdict": "clean"`},
+		{"insult", "Analyze if the following comment is toxic.\nComment: \"you are an idiot\"", `"harassment": 0.8`},
+		{"threat", "Analyze if the following comment is toxic.\nComment: \"I will hurt you\"", `"threat": 0.95`},
+		{"profanity", "Analyze if the following comment is toxic.\nComment: \"this sucks\"", `"profanity": 0.6`},
+		{"mask echoes the comment", "Original comment: \"hello there\"\nMasked comment:", "hello there"},
+		{"rewrite", "Original comment: \"you idiot\"\nModerated comment:", "I am unhappy with this and would like it to be improved."},
+		{"positive sentiment", "Analyze the sentiment of this comment.\nComment: \"great work\"", "positive"},
+		{"neutral sentiment", "Analyze the sentiment of this comment.\nComment: \"it arrived\"", "neutral"},
+		{"assistant", "You are a helpful assistant. Reply to the comment.", "Thank you for your comment."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := llms.GenerateFromSinglePrompt(context.Background(), model, tt.prompt)
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeModelNoMatch(t *testing.T) {
+	model, err := NewFakeModel(config.ModelConfig{Provider: "fake", Model: "fake-model"})
+	if err != nil {
+		t.Fatalf("NewFakeModel: %v", err)
+	}
+	if _, err := llms.GenerateFromSinglePrompt(context.Background(), model, "something else entirely"); err == nil {
+		t.Fatal("expected an error for a prompt no rule matches")
+	}
+}
+
+func TestFakeModelRulesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	rules := `[
+		{"match": "(?i)rate limit", "error": "slow down", "status": 429},
+		{"match": "(?i)broken", "error": "connection reset"},
+		{"match": "name is (\\w+)", "response": "hello $1"}
+	]`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	model, err := NewFakeModel(config.ModelConfig{Provider: "fake", Model: "fake-model", RulesFile: path})
+	if err != nil {
+		t.Fatalf("NewFakeModel: %v", err)
+	}
+	ctx := context.Background()
+
+	got, err := llms.GenerateFromSinglePrompt(ctx, model, "my name is Ada")
+	if err != nil || got != "hello Ada" {
+		t.Errorf("capture group: got %q, %v", got, err)
+	}
+
+	_, err = llms.GenerateFromSinglePrompt(ctx, model, "hit the rate limit")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 429 {
+		t.Errorf("status rule: got %v, want an APIError with status 429", err)
+	}
+
+	_, err = llms.GenerateFromSinglePrompt(ctx, model, "it is broken")
+	if err == nil || errors.As(err, &apiErr) {
+		t.Errorf("error rule: got %v, want a plain error", err)
+	}
+}
+
+func TestFakeModelStreams(t *testing.T) {
+	model, err := NewFakeModel(config.ModelConfig{Provider: "fake", Model: "fake-model"})
+	if err != nil {
+		t.Fatalf("NewFakeModel: %v", err)
+	}
+
+	var chunks []string
+	got, err := llms.GenerateFromSinglePrompt(context.Background(), model,
+		"Original comment: \"you idiot\"\nModerated comment:",
+		llms.WithStreamingFunc(func(_ context.Context, chunk []byte) error {
+			chunks = append(chunks, string(chunk))
+			return nil
+		}))
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Errorf("got %d chunks, want the response streamed word by word", len(chunks))
+	}
+	if joined := strings.Join(chunks, ""); joined != got {
+		t.Errorf("chunks join to %q, want %q", joined, got)
+	}
+}
+
+func TestFakeEmbeddingsAreDeterministic(t *testing.T) {
+	model, err := NewFakeModel(config.ModelConfig{Provider: "fake", Model: "fake-embed"})
+	if err != nil {
+		t.Fatalf("NewFakeModel: %v", err)
+	}
+	embedder := model.(Embedder)
+
+	vectors, err := embedder.CreateEmbedding(context.Background(), []string{
+		"this product is terrible",
+		"this product is terrible",
+		"this product is really terrible",
+		"the weather in Lisbon",
+	})
+	if err != nil {
+		t.Fatalf("CreateEmbedding: %v", err)
+	}
+
+	same, near, far := cosine(vectors[0], vectors[1]), cosine(vectors[0], vectors[2]), cosine(vectors[0], vectors[3])
+	if same < 0.999 {
+		t.Errorf("identical texts: similarity %f, want 1", same)
+	}
+	if near <= far {
+		t.Errorf("near-duplicate similarity %f should exceed unrelated %f", near, far)
+	}
+}
+
+func cosine(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_llm_requests_total",
+		Help: "LLM calls by model and outcome (success, error, rejected)",
+	}, []string{"model", "outcome"})
+
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "reword_llm_request_duration_seconds",
+		Help:    "Latency of individual LLM call attempts",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"model"})
+
+	retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_llm_retries_total",
+		Help: "LLM call attempts retried after a transient failure",
+	}, []string{"model"})
+
+	fallbacksTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_llm_fallbacks_total",
+		Help: "Calls served by a fallback model instead of the role's primary",
+	}, []string{"role", "model"})
+
+	concurrencyLimit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "reword_llm_concurrency_limit",
+		Help: "Concurrent calls allowed per model",
+	}, []string{"model"})
+
+	inflightGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "reword_llm_inflight",
+		Help: "LLM calls currently running per model",
+	}, []string{"model"})
+
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "reword_llm_queue_depth",
+		Help: "Calls waiting for a concurrency slot per model",
+	}, []string{"model"})
+
+	queueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "reword_llm_queue_wait_seconds",
+		Help:    "Time spent waiting for a concurrency slot",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"model"})
+
+	bulkheadRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_llm_bulkhead_rejected_total",
+		Help: "Calls rejected by a model's bulkhead by reason (queue_full, queue_timeout)",
+	}, []string{"model", "reason"})
+
+	adaptiveAdjustmentsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_llm_concurrency_adjustments_total",
+		Help: "Adaptive concurrency limit changes by direction (increase, decrease_throttled, decrease_latency)",
+	}, []string{"model", "direction"})
+
+	tokensTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reword_llm_tokens_total",
+		Help: "Tokens spent per role and model by kind (prompt, completion)",
+	}, []string{"role", "model", "kind"})
+
+	circuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "reword_llm_circuit_state",
+		Help: "Circuit breaker state per model (0 closed, 1 half-open, 2 open)",
+	}, []string{"model"})
+)
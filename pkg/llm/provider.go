@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/harshaSenaratne/reword/internal/config"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+// ProviderFactory builds a model for a role from its configuration
+type ProviderFactory func(cfg config.ModelConfig) (llms.Model, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]ProviderFactory{
+		"openai":            newOpenAIModel,
+		"openai-compatible": newCompatibleModel,
+		"anthropic":         newAnthropicModel,
+		"ollama":            newOllamaModel,
+		"fake":              NewFakeModel,
+	}
+)
+
+// RegisterProvider makes a provider backend available by name
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+// NewModel creates a model using the provider named in cfg
+func NewModel(cfg config.ModelConfig) (llms.Model, error) {
+	providersMu.RLock()
+	factory, ok := providers[cfg.Provider]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.Provider)
+	}
+
+	return factory(cfg)
+}
+
+func newOpenAIModel(cfg config.ModelConfig) (llms.Model, error) {
+	opts := []openai.Option{
+		openai.WithToken(cfg.APIKey),
+		openai.WithModel(cfg.Model),
+		openai.WithEmbeddingModel(cfg.Model),
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, openai.WithBaseURL(cfg.BaseURL))
+	}
+
+	return openai.New(append(opts, openai.WithHTTPClient(newHTTPClient(cfg.Headers)))...)
+}
+
+func newCompatibleModel(cfg config.ModelConfig) (llms.Model, error) {
+	// Self-hosted servers often need no key, but the openai client refuses an empty one
+	if cfg.APIKey == "" {
+		cfg.APIKey = "unused"
+	}
+
+	return newOpenAIModel(cfg)
+}
+
+func newAnthropicModel(cfg config.ModelConfig) (llms.Model, error) {
+	opts := []anthropic.Option{
+		anthropic.WithToken(cfg.APIKey),
+		anthropic.WithModel(cfg.Model),
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, anthropic.WithBaseURL(cfg.BaseURL))
+	}
+
+	return anthropic.New(append(opts, anthropic.WithHTTPClient(newHTTPClient(cfg.Headers)))...)
+}
+
+func newOllamaModel(cfg config.ModelConfig) (llms.Model, error) {
+	opts := []ollama.Option{
+		ollama.WithModel(cfg.Model),
+	}
+	if cfg.BaseURL != "" {
+		opts = append(opts, ollama.WithServerURL(cfg.BaseURL))
+	}
+
+	return ollama.New(append(opts, ollama.WithHTTPClient(newHTTPClient(cfg.Headers)))...)
+}
+
+// transport adds fixed headers to every outgoing request and reports the
+// upstream status of failed calls back to the resilience layer
+type transport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func newHTTPClient(headers map[string]string) *http.Client {
+	return &http.Client{
+		Transport: &transport{headers: headers, base: http.DefaultTransport},
+	}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) > 0 {
+		req = req.Clone(req.Context())
+		for k, v := range t.headers {
+			req.Header.Set(k, v)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if status := callStatusFrom(req.Context()); status != nil {
+		status.observe(resp, err)
+	}
+	return resp, err
+}
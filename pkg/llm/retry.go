@@ -0,0 +1,213 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// APIError carries the upstream HTTP status of a failed call. StatusCode is 0
+// when the request never got a response (connection errors).
+type APIError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("provider unreachable: %v", e.Err)
+	}
+	return fmt.Sprintf("provider returned %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether the call is worth retrying
+func (e *APIError) Transient() bool {
+	return e.StatusCode == 0 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Throttled reports whether the provider asked us to slow down (529 is
+// Anthropic's overloaded status)
+func (e *APIError) Throttled() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode == 529
+}
+
+// callStatus is filled in by the provider transport during a single attempt
+type callStatus struct {
+	mu         sync.Mutex
+	statusCode int
+	retryAfter time.Duration
+	failed     bool
+}
+
+type callStatusKey struct{}
+
+func withCallStatus(ctx context.Context) (context.Context, *callStatus) {
+	status := &callStatus{}
+	return context.WithValue(ctx, callStatusKey{}, status), status
+}
+
+func callStatusFrom(ctx context.Context) *callStatus {
+	status, _ := ctx.Value(callStatusKey{}).(*callStatus)
+	return status
+}
+
+func (s *callStatus) observe(resp *http.Response, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.failed = true
+		s.statusCode = 0
+		return
+	}
+	if resp.StatusCode < 400 {
+		return
+	}
+	s.failed = true
+	s.statusCode = resp.StatusCode
+	s.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+}
+
+// wraps err with the observed upstream status, if the transport saw a failure
+func (s *callStatus) wrap(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var apiErr *APIError
+	if !s.failed || errors.As(err, &apiErr) {
+		return err
+	}
+	return &APIError{StatusCode: s.statusCode, RetryAfter: s.retryAfter, Err: err}
+}
+
+// accepts both delay-seconds and HTTP-date forms
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// RetryPolicy controls jittered exponential backoff between attempts
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// Delay before retry number attempt (0-based), preferring the server's Retry-After
+func (p RetryPolicy) Delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		if p.MaxDelay > 0 && retryAfter > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return retryAfter
+	}
+
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// Equal jitter: keep half the delay, randomize the rest
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// resilientModel retries transient failures and guards the provider with a
+// breaker and a bulkhead
+type resilientModel struct {
+	model    llms.Model
+	name     string
+	policy   RetryPolicy
+	breaker  *CircuitBreaker
+	bulkhead *Bulkhead
+	limiter  *AdaptiveLimiter
+}
+
+func (m *resilientModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	for attempt := 0; ; attempt++ {
+		if err := m.breaker.Allow(); err != nil {
+			requestsTotal.WithLabelValues(m.name, "rejected").Inc()
+			return nil, fmt.Errorf("model %s: %w", m.name, err)
+		}
+
+		if err := m.bulkhead.Acquire(ctx); err != nil {
+			m.breaker.Release()
+			requestsTotal.WithLabelValues(m.name, "rejected").Inc()
+			return nil, err
+		}
+
+		// A streaming caller has to drop what a failed attempt already sent
+		streamFrom(ctx).restart()
+
+		attemptCtx, status := withCallStatus(ctx)
+		start := time.Now()
+		resp, err := m.model.GenerateContent(attemptCtx, messages, options...)
+		m.bulkhead.Release()
+		elapsed := time.Since(start)
+		requestDuration.WithLabelValues(m.name).Observe(elapsed.Seconds())
+		if err == nil {
+			m.breaker.Success()
+			m.limiter.Success(elapsed)
+			requestsTotal.WithLabelValues(m.name, "success").Inc()
+			return resp, nil
+		}
+		requestsTotal.WithLabelValues(m.name, "error").Inc()
+		err = status.wrap(err)
+
+		if ctx.Err() != nil {
+			m.breaker.Release()
+			return nil, err
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Transient() {
+			// The provider answered; the request itself was bad
+			m.breaker.Release()
+			return nil, err
+		}
+
+		if apiErr.Throttled() {
+			m.limiter.Throttled()
+		}
+		m.breaker.Failure()
+		if attempt >= m.policy.MaxRetries {
+			return nil, err
+		}
+
+		retriesTotal.WithLabelValues(m.name).Inc()
+		timer := time.NewTimer(m.policy.Delay(attempt, apiErr.RetryAfter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (m *resilientModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
@@ -0,0 +1,171 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// scriptedModel fails with errs in order, then answers "ok"
+type scriptedModel struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (m *scriptedModel) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.calls <= len(m.errs) {
+		return nil, m.errs[m.calls-1]
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "ok"}}}, nil
+}
+
+func (m *scriptedModel) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, m, prompt, options...)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"", 0, 0},
+		{"3", 3 * time.Second, 3 * time.Second},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v-%v", tt.value, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestCallStatusWrapsUpstreamFailure(t *testing.T) {
+	_, status := withCallStatus(context.Background())
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"2"}}}
+	status.observe(resp, nil)
+
+	var apiErr *APIError
+	if err := status.wrap(errors.New("rate limited")); !errors.As(err, &apiErr) {
+		t.Fatalf("got %v, want an APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.RetryAfter != 2*time.Second || !apiErr.Throttled() {
+		t.Errorf("unexpected %+v", apiErr)
+	}
+
+	// Nothing observed, nothing wrapped
+	_, clean := withCallStatus(context.Background())
+	clean.observe(&http.Response{StatusCode: http.StatusOK}, nil)
+	if err := clean.wrap(errors.New("parse error")); errors.As(err, new(*APIError)) {
+		t.Errorf("wrapped a call that never failed upstream: %v", err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	if got := policy.Delay(0, 300*time.Millisecond); got != 300*time.Millisecond {
+		t.Errorf("Retry-After: %v, want 300ms", got)
+	}
+	if got := policy.Delay(0, time.Minute); got != time.Second {
+		t.Errorf("Retry-After over the cap: %v, want 1s", got)
+	}
+
+	tests := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			if got := policy.Delay(tt.attempt, 0); got < tt.min || got > tt.max {
+				t.Fatalf("Delay(%d) = %v, want %v-%v", tt.attempt, got, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestResilientModelRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		errs    []error
+		calls   int
+		wantErr bool
+		state   CircuitState
+		waited  time.Duration
+	}{
+		{"success", nil, 1, false, CircuitClosed, 0},
+		{"429 honours Retry-After", []error{&APIError{StatusCode: 429, RetryAfter: 20 * time.Millisecond, Err: errors.New("slow down")}}, 2, false, CircuitClosed, 20 * time.Millisecond},
+		{"non-retryable", []error{&APIError{StatusCode: 400, Err: errors.New("bad request")}}, 1, true, CircuitClosed, 0},
+		{"plain error", []error{errors.New("malformed response")}, 1, true, CircuitClosed, 0},
+		{"retries run out", []error{
+			&APIError{StatusCode: 503, RetryAfter: time.Millisecond, Err: errors.New("unavailable")},
+			&APIError{StatusCode: 502, RetryAfter: time.Millisecond, Err: errors.New("bad gateway")},
+			&APIError{StatusCode: 503, RetryAfter: time.Millisecond, Err: errors.New("unavailable")},
+		}, 3, true, CircuitOpen, 2 * time.Millisecond},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &scriptedModel{errs: tt.errs}
+			name := "test-retry-" + string(rune('a'+i))
+			model := &resilientModel{
+				model: fake,
+				name:  name,
+				// A Retry-After is waited instead of the hour-long backoff
+				policy:   RetryPolicy{MaxRetries: 2, BaseDelay: time.Hour, MaxDelay: time.Hour},
+				breaker:  NewCircuitBreaker(name, 3, time.Hour),
+				bulkhead: NewBulkhead(name, 0, 0, 0),
+			}
+
+			start := time.Now()
+			_, err := model.Call(context.Background(), "hello")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if fake.calls != tt.calls {
+				t.Errorf("%d calls, want %d", fake.calls, tt.calls)
+			}
+			if got := model.breaker.State(); got != tt.state {
+				t.Errorf("breaker %s, want %s", got, tt.state)
+			}
+			if elapsed := time.Since(start); elapsed < tt.waited {
+				t.Errorf("done after %v, before the Retry-After of %v", elapsed, tt.waited)
+			}
+		})
+	}
+}
+
+func TestResilientModelStopsOnCancel(t *testing.T) {
+	fake := &scriptedModel{errs: []error{&APIError{StatusCode: 503, Err: errors.New("unavailable")}}}
+	model := &resilientModel{
+		model:    fake,
+		name:     "test-retry-cancel",
+		policy:   RetryPolicy{MaxRetries: 5, BaseDelay: time.Hour},
+		breaker:  NewCircuitBreaker("test-retry-cancel", 5, time.Hour),
+		bulkhead: NewBulkhead("test-retry-cancel", 0, 0, 0),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := model.Call(ctx, "hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the deadline", err)
+	}
+	if fake.calls != 1 {
+		t.Errorf("%d calls, want 1", fake.calls)
+	}
+}
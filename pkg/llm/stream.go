@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// StreamHandler receives a reply while it is generated. Reset is called when
+// an attempt that had already streamed text failed and the reply starts over
+// on a retry or a fallback model, so receivers must discard what they got.
+type StreamHandler interface {
+	Chunk(text string) error
+	Reset()
+}
+
+// stream tracks whether the current attempt has emitted anything
+type stream struct {
+	handler StreamHandler
+
+	mu    sync.Mutex
+	dirty bool
+}
+
+type streamKey struct{}
+
+func streamFrom(ctx context.Context) *stream {
+	s, _ := ctx.Value(streamKey{}).(*stream)
+	return s
+}
+
+func (s *stream) chunk(_ context.Context, chunk []byte) error {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+	return s.handler.Chunk(string(chunk))
+}
+
+// restart is called before every attempt; nil-safe so unstreamed calls skip it
+func (s *stream) restart() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	dirty := s.dirty
+	s.dirty = false
+	s.mu.Unlock()
+	if dirty {
+		s.handler.Reset()
+	}
+}
+
+// Stream is Generate with the reply delivered to handler as it arrives
+func (c *Client) Stream(ctx context.Context, role Role, prompt string, handler StreamHandler, options ...llms.CallOption) (*Generation, error) {
+	s := &stream{handler: handler}
+	ctx = context.WithValue(ctx, streamKey{}, s)
+	return c.Generate(ctx, role, prompt, append(options, llms.WithStreamingFunc(s.chunk))...)
+}
+
+// replays a complete reply word by word to a streaming caller, for models
+// that don't stream themselves (fakes, cassette replays)
+func streamText(ctx context.Context, options []llms.CallOption, text string) error {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if opts.StreamingFunc == nil {
+		return nil
+	}
+
+	// Chunks look like tokens: a word with its leading space
+	for len(text) > 0 {
+		end := len(text)
+		if i := strings.IndexByte(text[1:], ' '); i >= 0 {
+			end = i + 1
+		}
+		if err := opts.StreamingFunc(ctx, []byte(text[:end])); err != nil {
+			return err
+		}
+		text = text[end:]
+	}
+	return nil
+}
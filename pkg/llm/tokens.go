@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// TokenUsage counts the tokens spent on a call
+type TokenUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+func (u TokenUsage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Add sums usage across several calls
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+	}
+}
+
+// models without a tiktoken encoding (Claude, Llama, ...) are counted with this
+// one, which is close enough for budgets and estimates
+const fallbackEncoding = "cl100k_base"
+
+var (
+	encodingsMu sync.Mutex
+	encodings   = make(map[string]*tiktoken.Tiktoken)
+)
+
+func init() {
+	// Ship the BPE ranks in the binary instead of downloading them at runtime
+	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
+}
+
+// encoding returns the cached tokenizer for model, nil if none could be loaded
+func encoding(model string) *tiktoken.Tiktoken {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	if enc, ok := encodings[model]; ok {
+		return enc
+	}
+	enc, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		enc, err = tiktoken.GetEncoding(fallbackEncoding)
+	}
+	if err != nil {
+		enc = nil
+	}
+	encodings[model] = enc
+	return enc
+}
+
+// CountTokens returns the number of tokens text takes for model
+func CountTokens(model, text string) int {
+	enc := encoding(model)
+	if enc == nil {
+		// Roughly four characters per token
+		return (len([]rune(text)) + 3) / 4
+	}
+	return len(enc.EncodeOrdinary(text))
+}
+
+// TruncateTokens cuts text down to at most limit tokens for model
+func TruncateTokens(model, text string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+
+	enc := encoding(model)
+	if enc == nil {
+		runes := []rune(text)
+		if len(runes) <= limit*4 {
+			return text
+		}
+		return string(runes[:limit*4])
+	}
+
+	tokens := enc.EncodeOrdinary(text)
+	if len(tokens) <= limit {
+		return text
+	}
+	// A character can span tokens; don't leave half of one at the end
+	truncated := enc.Decode(tokens[:limit])
+	for len(truncated) > 0 {
+		r, size := utf8.DecodeLastRuneInString(truncated)
+		if r != utf8.RuneError || size > 1 {
+			break
+		}
+		truncated = truncated[:len(truncated)-size]
+	}
+	return truncated
+}
+
+// reads the usage reported by the provider, counting locally when it sent none
+// (fake models, cassette replays)
+func usageFrom(model, prompt string, resp *llms.ContentResponse) TokenUsage {
+	var usage TokenUsage
+	var completion string
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		completion = choice.Content
+		usage.PromptTokens = firstInt(choice.GenerationInfo, "PromptTokens", "InputTokens")
+		usage.CompletionTokens = firstInt(choice.GenerationInfo, "CompletionTokens", "OutputTokens")
+	}
+
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = CountTokens(model, prompt)
+	}
+	if usage.CompletionTokens == 0 {
+		usage.CompletionTokens = CountTokens(model, completion)
+	}
+	return usage
+}
+
+func firstInt(info map[string]any, keys ...string) int {
+	for _, key := range keys {
+		if v, ok := info[key].(int); ok && v > 0 {
+			return v
+		}
+	}
+	return 0
+}
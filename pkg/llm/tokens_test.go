@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		text  string
+		limit int
+	}{
+		{"at the budget", "gpt-3.5-turbo", "hello there friend", 3},
+		{"just over", "gpt-3.5-turbo", "hello there friend", 2},
+		{"far over", "gpt-3.5-turbo", strings.Repeat("lorem ipsum dolor sit amet ", 200), 10},
+		{"multibyte", "gpt-3.5-turbo", strings.Repeat("日本語のコメントです。", 50), 7},
+		{"emoji", "gpt-3.5-turbo", strings.Repeat("👍🏽🔥 ", 40), 5},
+		{"unknown model", "some-local-model", strings.Repeat("été ", 20), 3},
+		{"zero limit", "gpt-3.5-turbo", "hello", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TruncateTokens(tt.model, tt.text, tt.limit)
+			if n := CountTokens(tt.model, got); n > tt.limit {
+				t.Errorf("%d tokens, want at most %d", n, tt.limit)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("cut through a character: %q", got)
+			}
+			if !strings.HasPrefix(tt.text, got) {
+				t.Errorf("%q is not a prefix of the text", got)
+			}
+			if CountTokens(tt.model, tt.text) <= tt.limit && got != tt.text {
+				t.Errorf("text within the budget was cut to %q", got)
+			}
+		})
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	if n := CountTokens("gpt-3.5-turbo", "hello world"); n != 2 {
+		t.Errorf("known model: %d tokens, want 2", n)
+	}
+	// Models without an encoding of their own are counted with cl100k_base
+	if n, want := CountTokens("some-local-model", "ééééé bonjour"), CountTokens("gpt-4", "ééééé bonjour"); n != want {
+		t.Errorf("unknown model: %d tokens, want %d", n, want)
+	}
+	if n := CountTokens("gpt-3.5-turbo", ""); n != 0 {
+		t.Errorf("empty text: %d tokens", n)
+	}
+}